@@ -0,0 +1,35 @@
+// Command protoc-gen-go-ras is a protoc plugin that generates MarshalRAS,
+// UnmarshalRAS and SizeRAS methods for the Go types of protobuf messages.
+// The wire layout is read from the v8platform.ras.serialize.tags options
+// of the fields and oneofs, see ras.ProtoFields.
+//
+// It runs next to protoc-gen-go and writes a file with the _ras.pb.go
+// suffix into the same package, for example in buf.gen.yaml:
+//
+//	plugins:
+//	  - name: go-ras
+//	    out: ./gen/go
+//	    opt: paths=source_relative
+//
+// Nested messages are coded by their own generated methods, so the files
+// of the messages they use must be generated by the plugin too.
+package main
+
+import (
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+func main() {
+
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		for _, f := range gen.Files {
+			if !f.Generate {
+				continue
+			}
+			if err := generateFile(gen, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/v8platform/encoder/internal/prototag"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate_Golden(t *testing.T) {
+
+	data, err := os.ReadFile("../../image.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := prototag.UnmarshalSet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &pluginpb.CodeGeneratorRequest{
+		Parameter: proto.String("paths=source_relative"),
+		ProtoFile: set.GetFile(),
+	}
+	for _, f := range set.GetFile() {
+		if strings.HasPrefix(f.GetName(), "v8platform/ras/serialize/") {
+			req.FileToGenerate = append(req.FileToGenerate, f.GetName())
+		}
+	}
+
+	for _, f := range generate(t, req) {
+		golden := filepath.Join("testdata", path.Base(f.GetName())+".golden")
+
+		if *update {
+			if err := os.WriteFile(golden, []byte(f.GetContent()), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal([]byte(f.GetContent()), want) {
+			t.Errorf("%s differs from %s, run go test -update", f.GetName(), golden)
+		}
+	}
+}
+
+// generate runs the plugin on the request and returns the files it generates.
+func generate(t *testing.T, req *pluginpb.CodeGeneratorRequest) []*pluginpb.CodeGeneratorResponse_File {
+
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range gen.Files {
+		if f.Generate {
+			if err := generateFile(gen, f); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	resp := gen.Response()
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+
+	if len(resp.GetFile()) == 0 {
+		t.Fatal("no files generated")
+	}
+
+	return resp.GetFile()
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"fmt"
+	"github.com/v8platform/encoder/ras"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sort"
+	"strings"
+)
+
+const (
+	fmtPackage = protogen.GoImportPath("fmt")
+	ioPackage  = protogen.GoImportPath("io")
+	rasPackage = protogen.GoImportPath("github.com/v8platform/encoder/ras")
+)
+
+// generateFile writes the methods of the messages of the file.
+func generateFile(gen *protogen.Plugin, file *protogen.File) error {
+
+	messages := allMessages(file.Messages)
+	if len(messages) == 0 {
+		return nil
+	}
+
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_ras.pb.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-go-ras. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+
+	for _, m := range messages {
+		if err := genMessage(g, m); err != nil {
+			return fmt.Errorf("protoc-gen-go-ras: %s: %w", file.Desc.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+// allMessages returns the messages and their nested messages, without map entries.
+func allMessages(messages []*protogen.Message) []*protogen.Message {
+
+	var all []*protogen.Message
+	for _, m := range messages {
+		if m.Desc.IsMapEntry() {
+			continue
+		}
+		all = append(all, m)
+		all = append(all, allMessages(m.Messages)...)
+	}
+
+	return all
+}
+
+func genMessage(g *protogen.GeneratedFile, message *protogen.Message) error {
+
+	fields, err := ras.ProtoFields(message.Desc)
+	if err != nil {
+		return err
+	}
+
+	e := &emitter{
+		message: message,
+		fields:  map[protoreflect.FieldDescriptor]*protogen.Field{},
+		oneofs:  map[protoreflect.OneofDescriptor]*protogen.Oneof{},
+	}
+	for _, f := range message.Fields {
+		e.fields[f.Desc] = f
+	}
+	for _, o := range message.Oneofs {
+		e.oneofs[o.Desc] = o
+	}
+
+	for _, f := range fields {
+		if err := check(f); err != nil {
+			return fmt.Errorf("%s.%s: %w", message.Desc.Name(), f.Name, err)
+		}
+		e.optionsVars(g, f)
+	}
+
+	name := message.GoIdent.GoName
+
+	e.begin()
+	for _, f := range fields {
+		e.encodeField(f)
+	}
+	g.P("// MarshalRAS writes the message in the protocol version.")
+	g.P("func (x *", name, ") MarshalRAS(w ", ioPackage.Ident("Writer"), ", version int) (int, error) {")
+	e.end(g, "c := ", rasPackage.Ident("NewCodecWriter"), "()")
+
+	e.begin()
+	for _, f := range fields {
+		e.decodeField(f)
+	}
+	g.P("// UnmarshalRAS reads the message in the protocol version.")
+	g.P("func (x *", name, ") UnmarshalRAS(r ", ioPackage.Ident("Reader"), ", version int) (int, error) {")
+	e.end(g, "c := ", rasPackage.Ident("NewCodecReader"), "()")
+
+	g.P("// SizeRAS returns the number of bytes MarshalRAS writes.")
+	g.P("func (x *", name, ") SizeRAS(version int) (int, error) {")
+	g.P("return x.MarshalRAS(", ioPackage.Ident("Discard"), ", version)")
+	g.P("}")
+	g.P()
+
+	return nil
+}
+
+// check reports the layouts the generated code does not support
+// beyond those ras.ProtoFields rejects.
+func check(f ras.ProtoField) error {
+
+	fds := []protoreflect.FieldDescriptor{f.Field}
+	if f.Oneof != nil {
+		fds = fds[:0]
+		for _, c := range f.Cases {
+			fds = append(fds, c.Field)
+		}
+	}
+
+	for _, fd := range fds {
+		if fd.HasOptionalKeyword() {
+			return fmt.Errorf("optional fields are not supported")
+		}
+	}
+
+	return nil
+}
+
+// emitter writes the body of a method.
+type emitter struct {
+	message *protogen.Message
+	fields  map[protoreflect.FieldDescriptor]*protogen.Field
+	oneofs  map[protoreflect.OneofDescriptor]*protogen.Oneof
+
+	lines [][]interface{}
+	names map[string]int
+	calls int  // codec calls in the body
+	codec bool // the body uses the CodecWriter or CodecReader
+}
+
+func (e *emitter) begin() {
+	e.lines = nil
+	e.names = map[string]int{}
+	e.calls = 0
+	e.codec = false
+}
+
+// end writes the method body, declaring what it uses.
+func (e *emitter) end(g *protogen.GeneratedFile, codec ...interface{}) {
+
+	if e.calls == 0 {
+		g.P("return 0, nil")
+		g.P("}")
+		g.P()
+		return
+	}
+
+	g.P()
+	if e.codec {
+		g.P(codec...)
+		g.P()
+	}
+	g.P("var total int")
+	g.P("var n int")
+	g.P("var err error")
+	g.P()
+	for _, line := range e.lines {
+		g.P(line...)
+	}
+	g.P("return total, nil")
+	g.P("}")
+	g.P()
+}
+
+func (e *emitter) P(v ...interface{}) {
+	e.lines = append(e.lines, v)
+}
+
+// call writes a call whose results are assigned to lhs, which ends with n and err.
+func (e *emitter) call(lhs string, v ...interface{}) {
+
+	e.calls++
+	if s, ok := v[0].(string); ok && strings.HasPrefix(s, "c.") {
+		e.codec = true
+	}
+
+	e.P(append([]interface{}{lhs, " = "}, v...)...)
+	e.P("total += n")
+	e.P("if err != nil {")
+	e.P("return total, err")
+	e.P("}")
+}
+
+// tmp returns a new local variable name.
+func (e *emitter) tmp(prefix string) string {
+
+	i := e.names[prefix]
+	e.names[prefix]++
+	if i == 0 {
+		return prefix
+	}
+
+	return fmt.Sprintf("%s%d", prefix, i)
+}
+
+// optionsVars declares the variables holding the codec options of the field.
+func (e *emitter) optionsVars(g *protogen.GeneratedFile, f ras.ProtoField) {
+
+	fields := []ras.ProtoField{f}
+	if f.Oneof != nil {
+		fields = f.Cases
+	}
+
+	for _, f := range fields {
+		options := f.Options()
+		if len(options) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(options))
+		for k := range options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		g.P("var ", e.optionsName(f), " = map[string]string{")
+		for _, k := range keys {
+			g.P(fmt.Sprintf("%q: %q,", k, options[k]))
+		}
+		g.P("}")
+		g.P()
+	}
+}
+
+func (e *emitter) optionsName(f ras.ProtoField) string {
+	return "ras" + e.message.GoIdent.GoName + e.fields[f.Field].GoName + "Options"
+}
+
+// codecArgs returns the arguments of a codec call following the value.
+func (e *emitter) codecArgs(f ras.ProtoField) string {
+
+	if len(f.Options()) == 0 {
+		return ""
+	}
+
+	return ", " + e.optionsName(f)
+}
+
+// gate opens the condition on the protocol version for the field to be coded, if any.
+func (e *emitter) gate(f ras.ProtoField) func() {
+
+	var conds []string
+	if f.Version > 0 {
+		conds = append(conds, fmt.Sprintf("version >= %d", f.Version))
+	}
+	if f.Removed > 0 {
+		conds = append(conds, fmt.Sprintf("version < %d", f.Removed))
+	}
+
+	if len(conds) == 0 {
+		return func() {}
+	}
+
+	e.P("if ", strings.Join(conds, " && "), " {")
+	return func() { e.P("}") }
+}
+
+func (e *emitter) encodeField(f ras.ProtoField) {
+
+	closeGate := e.gate(f)
+	defer e.P()
+	defer closeGate()
+
+	if f.Oneof != nil {
+		e.encodeOneof(f)
+		return
+	}
+
+	field := e.fields[f.Field]
+	v := "x.Get" + field.GoName + "()"
+
+	if !f.Nullable {
+		e.encodeValue(f, v)
+		return
+	}
+
+	// A list or a message is null when it is not set, as ras.MarshalProto
+	// tells by protoreflect.Message.Has: an empty list or a nil message.
+	nilable := f.Field.IsList() || f.Field.Message() != nil
+	if nilable {
+		if f.Field.IsList() {
+			e.P("if len(", v, ") == 0 {")
+		} else {
+			e.P("if ", v, " == nil {")
+		}
+		e.call("n, err", "c.WriteNull(w)")
+		e.P("} else {")
+	}
+	if !f.NullInline() {
+		e.call("n, err", "c.WriteNullableSize(0, w)")
+	}
+	e.encodeValue(f, v)
+	if nilable {
+		e.P("}")
+	}
+}
+
+// encodeOneof writes the index of the field that is set and its value.
+func (e *emitter) encodeOneof(f ras.ProtoField) {
+
+	v := e.tmp("v")
+	e.P("switch ", v, " := x.Get", e.oneofs[f.Oneof].GoName, "().(type) {")
+	for i, c := range f.Cases {
+		field := e.fields[c.Field]
+		e.P("case *", field.GoIdent, ":")
+		e.call("n, err", fmt.Sprintf("c.WriteSize(%d, w)", i+1))
+		e.encodeValue(c, v+"."+field.GoName)
+	}
+	e.P("default:")
+	e.call("n, err", "c.WriteSize(0, w)")
+	e.P("}")
+}
+
+// encodeValue writes the value v of the field, which may be a list.
+func (e *emitter) encodeValue(f ras.ProtoField, v string) {
+
+	if !f.Field.IsList() {
+		e.encodeSingular(f, v)
+		return
+	}
+
+	e.call("n, err", "c.WriteSize(len(", v, "), w)")
+	elem := e.tmp("e")
+	e.P("for _, ", elem, " := range ", v, " {")
+	e.encodeSingular(f, elem)
+	e.P("}")
+}
+
+func (e *emitter) encodeSingular(f ras.ProtoField, v string) {
+
+	fd := f.Field
+
+	if codec := f.EncoderCodec(); codec != "" {
+		e.call("n, err", rasPackage.Ident("EncodeValue"), fmt.Sprintf("(%q, w, %s%s)", codec, v, e.codecArgs(f)))
+		return
+	}
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		e.call("n, err", "c.WriteInt32(int32(", v, "), w)")
+	case protoreflect.BytesKind:
+		e.call("n, err", "c.WriteSize(len(", v, "), w)")
+		e.call("n, err", "w.Write(", v, ")")
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if ras.ProtoKindCodec(fd) == "time" {
+			e.call("n, err", "c.WriteTime(", v, ", w)")
+			return
+		}
+		// The generated getters are safe on a nil message,
+		// which is written as the empty one.
+		e.call("n, err", v, ".MarshalRAS(w, version)")
+	default:
+		e.call("n, err", "c.", writers[ras.ProtoKindCodec(fd)], "(", v, ", w)")
+	}
+}
+
+func (e *emitter) decodeField(f ras.ProtoField) {
+
+	closeGate := e.gate(f)
+	defer e.P()
+	defer closeGate()
+
+	if f.Oneof != nil {
+		e.decodeOneof(f)
+		return
+	}
+
+	field := e.fields[f.Field]
+	v := "x." + field.GoName
+
+	if !f.Nullable {
+		e.decodeValue(f, v)
+		return
+	}
+
+	null := e.tmp("null")
+	e.P("var ", null, " bool")
+	e.call(null+", n, err", rasPackage.Ident("ReadNull"), fmt.Sprintf("(r, %t)", f.NullInline()))
+	e.P("if ", null, " {")
+	e.P(v, " = ", e.zero(field))
+	e.P("} else {")
+	e.decodeValue(f, v)
+	e.P("}")
+}
+
+// decodeOneof reads the index of the field that is set and its value.
+func (e *emitter) decodeOneof(f ras.ProtoField) {
+
+	oneof := e.oneofs[f.Oneof]
+	index := e.tmp("index")
+
+	e.P("var ", index, " int")
+	e.call(index+", n, err", "c.ReadSize(r)")
+	e.P("switch ", index, " {")
+	e.P("case 0:")
+	e.P("x.", oneof.GoName, " = nil")
+	for i, c := range f.Cases {
+		field := e.fields[c.Field]
+		v := e.tmp("v")
+		e.P(fmt.Sprintf("case %d:", i+1))
+		e.P(v, " := &", field.GoIdent, "{}")
+		e.decodeValue(c, v+"."+field.GoName)
+		e.P("x.", oneof.GoName, " = ", v)
+	}
+	e.P("default:")
+	e.P("return total, &", rasPackage.Ident("CodecError"), "{Name: \"oneof\", Msg: ",
+		fmtPackage.Ident("Sprintf"), fmt.Sprintf("(\"no field %%d in oneof %s\", %s)}", f.Oneof.Name(), index))
+	e.P("}")
+}
+
+// decodeValue reads the value of the field into v, which may be a list.
+func (e *emitter) decodeValue(f ras.ProtoField, v string) {
+
+	if !f.Field.IsList() {
+		e.decodeSingular(f, v, true)
+		return
+	}
+
+	size := e.tmp("size")
+	e.P("var ", size, " int")
+	e.call(size+", n, err", rasPackage.Ident("DecodeLen"), "(r)")
+	e.P(v, " = ", v, "[:0]")
+
+	i, elem := e.tmp("i"), e.tmp("e")
+	e.P("for ", i, " := 0; ", i, " < ", size, "; ", i, "++ {")
+	if f.Field.Message() != nil {
+		e.P(elem, " := new(", e.fields[f.Field].Message.GoIdent, ")")
+	} else {
+		e.P(append([]interface{}{"var ", elem, " "}, e.elemType(f.Field)...)...)
+	}
+	e.decodeSingular(f, elem, false)
+	e.P(v, " = append(", v, ", ", elem, ")")
+	e.P("}")
+}
+
+// decodeSingular reads a value into v. A nil message is allocated first if alloc is set.
+func (e *emitter) decodeSingular(f ras.ProtoField, v string, alloc bool) {
+
+	fd := f.Field
+	field := e.fields[fd]
+
+	if alloc && fd.Message() != nil {
+		e.P("if ", v, " == nil {")
+		e.P(v, " = new(", field.Message.GoIdent, ")")
+		e.P("}")
+	}
+
+	if codec := f.DecoderCodec(); codec != "" {
+		target := "&" + v
+		if fd.Message() != nil {
+			target = v
+		}
+		e.call("n, err", rasPackage.Ident("DecodeValue"), fmt.Sprintf("(%q, r, %s%s)", codec, target, e.codecArgs(f)))
+		return
+	}
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		e.call("n, err", "c.ReadInt32Ptr((*int32)(&", v, "), r)")
+	case protoreflect.BytesKind:
+		e.call(v+", n, err", rasPackage.Ident("DecodeBytes"), "(r)")
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if ras.ProtoKindCodec(fd) == "time" {
+			e.call("n, err", "c.ReadTimePtr(", v, ", r)")
+			return
+		}
+		e.call("n, err", v, ".UnmarshalRAS(r, version)")
+	default:
+		e.call("n, err", "c.", readers[ras.ProtoKindCodec(fd)], "(&", v, ", r)")
+	}
+}
+
+// elemType returns the Go type of an element of the list field.
+func (e *emitter) elemType(fd protoreflect.FieldDescriptor) []interface{} {
+
+	field := e.fields[fd]
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return []interface{}{field.Enum.GoIdent}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return []interface{}{"*", field.Message.GoIdent}
+	case protoreflect.BytesKind:
+		return []interface{}{"[]byte"}
+	}
+
+	return []interface{}{goTypes[ras.ProtoKindCodec(fd)]}
+}
+
+// zero returns the zero value of the field as Go code.
+func (e *emitter) zero(field *protogen.Field) string {
+
+	fd := field.Desc
+	switch {
+	case fd.IsList() || fd.Message() != nil || fd.Kind() == protoreflect.BytesKind:
+		return "nil"
+	case fd.Kind() == protoreflect.StringKind:
+		return `""`
+	case fd.Kind() == protoreflect.BoolKind:
+		return "false"
+	}
+
+	return "0"
+}
+
+var writers = map[string]string{
+	"bool":    "WriteBool",
+	"int32":   "WriteInt32",
+	"uint32":  "WriteUint32",
+	"int64":   "WriteInt64",
+	"uint64":  "WriteUint64",
+	"float32": "WriteFloat32",
+	"float64": "WriteFloat64",
+	"string":  "WriteString",
+}
+
+var readers = map[string]string{
+	"bool":    "ReadBoolPtr",
+	"int32":   "ReadInt32Ptr",
+	"uint32":  "ReadUint32Ptr",
+	"int64":   "ReadInt64Ptr",
+	"uint64":  "ReadUint64Ptr",
+	"float32": "ReadFloat32Ptr",
+	"float64": "ReadFloat64Ptr",
+	"string":  "ReadStringPtr",
+}
+
+var goTypes = map[string]string{
+	"bool":    "bool",
+	"int32":   "int32",
+	"uint32":  "uint32",
+	"int64":   "int64",
+	"uint64":  "uint64",
+	"float32": "float32",
+	"float64": "float64",
+	"string":  "string",
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"github.com/v8platform/encoder/ras"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+// TestGenerate_RoundTrip generates the message types of a test file with
+// protoc-gen-go and their methods with the plugin, then builds them and
+// runs roundTripTest, which checks the methods against ras.MarshalProto
+// and ras.UnmarshalProto.
+func TestGenerate_RoundTrip(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	// The package is built inside the module, so that it imports this ras package.
+	// The leading underscore keeps it out of ./... patterns.
+	dir, err := os.MkdirTemp(".", "_roundtrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	importPath := "github.com/v8platform/encoder/cmd/protoc-gen-go-ras/" + filepath.Base(dir)
+	req := &pluginpb.CodeGeneratorRequest{
+		Parameter:      proto.String("paths=source_relative"),
+		FileToGenerate: []string{"roundtrip.proto"},
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{roundTripFile(importPath)},
+	}
+
+	files := append(protocGenGo(t, goTool, req), generate(t, req)...)
+	files = append(files, &pluginpb.CodeGeneratorResponse_File{
+		Name:    proto.String("roundtrip_test.go"),
+		Content: proto.String(roundTripTest),
+	})
+
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, path.Base(f.GetName())), []byte(f.GetContent()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "test", "./"+filepath.Base(dir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test of the generated code: %v\n%s", err, out)
+	}
+}
+
+// protocGenGo runs protoc-gen-go on the request and returns the files it generates.
+func protocGenGo(t *testing.T, goTool string, req *pluginpb.CodeGeneratorRequest) []*pluginpb.CodeGeneratorResponse_File {
+
+	plugin := filepath.Join(t.TempDir(), "protoc-gen-go")
+	if out, err := exec.Command(goTool, "build", "-o", plugin, "google.golang.org/protobuf/cmd/protoc-gen-go").CombinedOutput(); err != nil {
+		t.Fatalf("build protoc-gen-go: %v\n%s", err, out)
+	}
+
+	in, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(plugin)
+	cmd.Stdin = bytes.NewReader(in)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("protoc-gen-go: %v", err)
+	}
+
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(out, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+
+	return resp.GetFile()
+}
+
+// roundTripFile returns a file with the field layouts the plugin supports:
+// nullable, versioned and removed fields, lists, bytes and a oneof.
+func roundTripFile(importPath string) *descriptorpb.FileDescriptorProto {
+
+	tags := func(tag string) *descriptorpb.FieldOptions {
+		b := protowire.AppendTag(nil, ras.ProtoTagsNumber, protowire.BytesType)
+		opts := &descriptorpb.FieldOptions{}
+		opts.ProtoReflect().SetUnknown(protowire.AppendString(b, tag))
+		return opts
+	}
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, tag string) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			fd.TypeName = proto.String(".roundtrip.Item")
+		}
+		if tag != "" {
+			fd.Options = tags(tag)
+		}
+		return fd
+	}
+
+	repeated := func(fd *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return fd
+	}
+
+	oneof := func(fd *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		fd.OneofIndex = proto.Int32(0)
+		return fd
+	}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("roundtrip.proto"),
+		Package: proto.String("roundtrip"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String(importPath + ";roundtrip")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")},
+			},
+			{
+				Name: proto.String("Frame"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, `ras:"1,nullable"`),
+					field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("data", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+					repeated(field("items", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, "")),
+					field("item", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, `ras:"5,nullable"`),
+					field("id", 6, descriptorpb.FieldDescriptorProto_TYPE_STRING, `ras:"6,version=5"`),
+					field("legacy", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, `ras:"7,removed=5"`),
+					repeated(field("blobs", 8, descriptorpb.FieldDescriptorProto_TYPE_BYTES, "")),
+					oneof(field("text", 9, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")),
+					oneof(field("sub", 10, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, "")),
+					repeated(field("tags", 11, descriptorpb.FieldDescriptorProto_TYPE_STRING, `ras:"11,nullable"`)),
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}},
+			},
+		},
+	}
+}
+
+// roundTripTest is the test run in the package of the generated code.
+const roundTripTest = `package roundtrip
+
+import (
+	"bytes"
+	"github.com/v8platform/encoder/ras"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	full := &Frame{
+		Name:   "frame",
+		Count:  -3,
+		Data:   []byte{1, 2, 3},
+		Items:  []*Item{{Name: "a"}, {Name: "b"}},
+		Item:   &Item{Name: "c"},
+		Id:     "id",
+		Legacy: "legacy",
+		Blobs:  [][]byte{{4}, {}},
+		Choice: &Frame_Text{Text: "text"},
+		Tags:   []string{"tag"},
+	}
+
+	sub := proto.Clone(full).(*Frame)
+	sub.Choice = &Frame_Sub{Sub: &Item{Name: "d"}}
+
+	// An empty list of a nullable field is null, as an absent one.
+	emptyList := proto.Clone(full).(*Frame)
+	emptyList.Tags = []string{}
+
+	for name, m := range map[string]*Frame{
+		"empty":      {},
+		"full":       full,
+		"sub":        sub,
+		"empty list": emptyList,
+	} {
+		for _, version := range []int{1, 5, 10} {
+
+			want, err := ras.MarshalProto(m, version)
+			if err != nil {
+				t.Fatalf("%s %d: MarshalProto() error = %v", name, version, err)
+			}
+
+			buf := &bytes.Buffer{}
+			if _, err := m.MarshalRAS(buf, version); err != nil || !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s %d: MarshalRAS() = %x, %v, want %x", name, version, buf.Bytes(), err, want)
+			}
+
+			if size, err := m.SizeRAS(version); err != nil || size != len(want) {
+				t.Errorf("%s %d: SizeRAS() = %d, %v, want %d", name, version, size, err, len(want))
+			}
+
+			expected := &Frame{}
+			if _, err := ras.UnmarshalProto(want, expected, version); err != nil {
+				t.Fatalf("%s %d: UnmarshalProto() error = %v", name, version, err)
+			}
+
+			got := &Frame{}
+			if n, err := got.UnmarshalRAS(bytes.NewReader(want), version); err != nil || n != len(want) || !proto.Equal(got, expected) {
+				t.Errorf("%s %d: UnmarshalRAS() = %v, %d, %v, want %v", name, version, got, n, err, expected)
+			}
+		}
+	}
+}
+`
@@ -0,0 +1,65 @@
+// Command rasgen generates MarshalRAS, UnmarshalRAS and SizeRAS methods
+// for structs tagged for the ras package, so that they are coded without
+// reflection. It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/v8platform/encoder/cmd/rasgen -type Session,Lock
+//
+// The methods write the same bytes as the reflective Encoder. Struct types
+// used by the fields must have methods of their own, so they are usually
+// listed in -type too. Discriminated interfaces are not supported.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/v8platform/encoder/internal/rasgen"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output    = flag.String("output", "", "output file name; default <type>_ras.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: rasgen -type T[,T...] [-output file] [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+
+	log.SetFlags(0)
+	log.SetPrefix("rasgen: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+
+	types := strings.Split(*typeNames, ",")
+
+	outputName := *output
+	if outputName == "" {
+		outputName = strings.ToLower(types[0]) + "_ras.go"
+	}
+	outputName = filepath.Join(dir, outputName)
+
+	src, err := rasgen.Generate(dir, types, outputName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package prototag loads descriptor sets whose fields carry the
+// v8platform.ras.serialize.tags options read by ras.ProtoFields.
+package prototag
+
+import (
+	"bytes"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// UnmarshalSet parses a FileDescriptorSet in the binary or the JSON encoding,
+// such as a buf image. The JSON encoding names the extensions of the options,
+// so they are resolved against the extensions declared in the set itself.
+func UnmarshalSet(data []byte) (*descriptorpb.FileDescriptorSet, error) {
+
+	set := &descriptorpb.FileDescriptorSet{}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		if err := proto.Unmarshal(data, set); err != nil {
+			return nil, fmt.Errorf("prototag: descriptor set: %w", err)
+		}
+		return set, nil
+	}
+
+	// The first pass finds the extensions, the second one keeps their values.
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("prototag: descriptor set: %w", err)
+	}
+
+	files, err := NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+
+	types := new(protoregistry.Types)
+	var regErr error
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		xds := fd.Extensions()
+		for i := 0; i < xds.Len(); i++ {
+			if err := types.RegisterExtension(dynamicpb.NewExtensionType(xds.Get(i))); err != nil {
+				regErr = err
+				return false
+			}
+		}
+		return true
+	})
+	if regErr != nil {
+		return nil, fmt.Errorf("prototag: descriptor set: %w", regErr)
+	}
+
+	set = &descriptorpb.FileDescriptorSet{}
+	opts := protojson.UnmarshalOptions{DiscardUnknown: true, Resolver: types}
+	if err := opts.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("prototag: descriptor set: %w", err)
+	}
+
+	return set, nil
+}
+
+// NewFiles builds the files of the set. Files linked into the program,
+// such as google/protobuf/descriptor.proto, are taken from the global
+// registry, so that extensions of the options extend the Go types.
+func NewFiles(set *descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+
+	files := new(protoregistry.Files)
+
+	for _, fdp := range set.GetFile() {
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(fdp.GetName())
+		if err != nil {
+			fd, err = protodesc.NewFile(fdp, files)
+			if err != nil {
+				return nil, fmt.Errorf("prototag: %s: %w", fdp.GetName(), err)
+			}
+		}
+
+		if err := files.RegisterFile(fd); err != nil {
+			return nil, fmt.Errorf("prototag: %s: %w", fdp.GetName(), err)
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,713 @@
+package rasgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Generate returns the source of a Go file declaring the methods of the named
+// struct types of the package in dir. The file output is left out of the
+// package, so that a stale generated file does not get in the way.
+//
+// Struct types of the package used by the fields must have methods of their
+// own: written by hand or generated in the same run.
+func Generate(dir string, typeNames []string, output string) ([]byte, error) {
+
+	pkg, err := load(dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		pkg:     pkg,
+		types:   map[types.Type]bool{},
+		imports: map[string]string{"io": "io"},
+	}
+
+	var named []*types.Named
+	for _, name := range typeNames {
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("rasgen: type %s not found in %s", name, dir)
+		}
+
+		t, ok := obj.Type().(*types.Named)
+		if !ok {
+			return nil, fmt.Errorf("rasgen: %s is not a struct type", name)
+		}
+		if _, ok := t.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("rasgen: %s is not a struct type", name)
+		}
+
+		g.types[t] = true
+		named = append(named, t)
+	}
+
+	for _, t := range named {
+		if err := g.genType(t); err != nil {
+			return nil, fmt.Errorf("rasgen: %s%w", t.Obj().Name(), err)
+		}
+	}
+
+	return g.file()
+}
+
+type generator struct {
+	pkg     *types.Package
+	types   map[types.Type]bool // types being generated
+	imports map[string]string   // package path to name
+	vars    bytes.Buffer        // package level variables
+	buf     bytes.Buffer        // methods
+
+	body  bytes.Buffer // body of the method being generated
+	names map[string]int
+	calls int  // codec calls in body
+	codec bool // body uses the CodecWriter or CodecReader
+}
+
+// file assembles and formats the generated file.
+func (g *generator) file() ([]byte, error) {
+
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "// Code generated by rasgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", g.pkg.Name())
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintf(&out, "import (\n")
+	for _, path := range paths {
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	fmt.Fprintf(&out, ")\n\n")
+
+	out.Write(g.vars.Bytes())
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("rasgen: formatting the output: %w", err)
+	}
+
+	return src, nil
+}
+
+func (g *generator) genType(t *types.Named) error {
+
+	fields, err := g.structFields(t)
+	if err != nil {
+		return fmt.Errorf(": %w", err)
+	}
+
+	for _, f := range fields {
+		if f.Discriminator != "" {
+			return fmt.Errorf(".%s: discriminated interfaces are not supported", f.path)
+		}
+	}
+
+	name := t.Obj().Name()
+	recv := receiver(name)
+
+	for _, f := range fields {
+		if len(f.Options()) > 0 {
+			g.optionsVar(name, f)
+		}
+	}
+
+	g.begin()
+	for _, f := range fields {
+		if err := g.encodeField(name, f, recv+"."+f.path); err != nil {
+			return fmt.Errorf(".%s: %w", f.path, err)
+		}
+	}
+	fmt.Fprintf(&g.buf, "// MarshalRAS writes %s in the protocol version.\n", name)
+	fmt.Fprintf(&g.buf, "func (%s *%s) MarshalRAS(w io.Writer, version int) (int, error) {\n\n", recv, name)
+	g.end("c := ras.NewCodecWriter()")
+
+	g.begin()
+	for _, f := range fields {
+		if err := g.decodeField(name, f, recv+"."+f.path); err != nil {
+			return fmt.Errorf(".%s: %w", f.path, err)
+		}
+	}
+	fmt.Fprintf(&g.buf, "// UnmarshalRAS reads %s in the protocol version.\n", name)
+	fmt.Fprintf(&g.buf, "func (%s *%s) UnmarshalRAS(r io.Reader, version int) (int, error) {\n\n", recv, name)
+	g.end("c := ras.NewCodecReader()")
+
+	fmt.Fprintf(&g.buf, "// SizeRAS returns the number of bytes MarshalRAS writes.\n")
+	fmt.Fprintf(&g.buf, "func (%s *%s) SizeRAS(version int) (int, error) {\n", recv, name)
+	fmt.Fprintf(&g.buf, "return %s.MarshalRAS(io.Discard, version)\n}\n\n", recv)
+
+	return nil
+}
+
+// begin starts the body of a method.
+func (g *generator) begin() {
+	g.body.Reset()
+	g.names = map[string]int{}
+	g.calls = 0
+	g.codec = false
+}
+
+// end writes the body of the method, declaring what it uses.
+func (g *generator) end(codec string) {
+
+	if g.calls == 0 {
+		fmt.Fprintf(&g.buf, "return 0, nil\n}\n\n")
+		return
+	}
+
+	g.useRas()
+	if g.codec {
+		fmt.Fprintf(&g.buf, "%s\n\n", codec)
+	}
+
+	fmt.Fprintf(&g.buf, "var total int\nvar n int\nvar err error\n\n")
+	g.buf.Write(g.body.Bytes())
+	fmt.Fprintf(&g.buf, "return total, nil\n}\n\n")
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// call writes a codec call whose results are assigned to lhs,
+// which ends with n and err.
+func (g *generator) call(lhs, format string, args ...interface{}) {
+
+	g.calls++
+	g.codec = g.codec || strings.HasPrefix(format, "c.")
+	g.printf("%s = %s\ntotal += n\nif err != nil {\nreturn total, err\n}\n", lhs, fmt.Sprintf(format, args...))
+}
+
+// tmp returns a new local variable name.
+func (g *generator) tmp(prefix string) string {
+
+	i := g.names[prefix]
+	g.names[prefix]++
+	if i == 0 {
+		return prefix
+	}
+
+	return fmt.Sprintf("%s%d", prefix, i)
+}
+
+// typ returns t as written in the generated file.
+func (g *generator) typ(t types.Type) string {
+
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+func (g *generator) useRas() {
+	g.imports[rasPath] = "ras"
+}
+
+// generating reports whether the methods of t are being generated.
+func (g *generator) generating(t types.Type) bool {
+	return g.types[t]
+}
+
+// optionsVar declares the variable holding the codec options of the field.
+func (g *generator) optionsVar(typeName string, f field) {
+
+	options := f.Options()
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(&g.vars, "var %s = map[string]string{\n", optionsName(typeName, f))
+	for _, k := range keys {
+		fmt.Fprintf(&g.vars, "%q: %q,\n", k, options[k])
+	}
+	fmt.Fprintf(&g.vars, "}\n\n")
+}
+
+// codecArgs returns the arguments of a codec call following the value.
+// The options of the fields of an anonymous struct are written in place.
+func codecArgs(typeName string, f field) string {
+
+	options := f.Options()
+	if len(options) == 0 {
+		return ""
+	}
+
+	if typeName != "" {
+		return ", " + optionsName(typeName, f)
+	}
+
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%q: %q", k, options[k]))
+	}
+
+	return ", map[string]string{" + strings.Join(pairs, ", ") + "}"
+}
+
+func optionsName(typeName string, f field) string {
+	return "ras" + typeName + strings.Replace(f.path, ".", "", -1) + "Options"
+}
+
+func (g *generator) encodeField(typeName string, f field, x string) error {
+
+	gate := versionGate(f)
+	if gate != "" {
+		g.printf("if %s {\n", gate)
+	}
+
+	// encode writes the value, which is known not to be nil
+	// if the field is nullable.
+	encode := func() error {
+		p, isPtr := f.typ.Underlying().(*types.Pointer)
+		codec := f.EncoderCodec()
+		switch {
+		case codec != "" && f.Nullable:
+			g.useRas()
+			g.call("n, err", "ras.EncodeValue(%q, w, %s%s)", codec, x, codecArgs(typeName, f))
+			return nil
+		case codec != "":
+			g.encodeCodec(codec, codecArgs(typeName, f), f.typ, x)
+			return nil
+		case isPtr && f.Nullable:
+			return g.encodeValue(p.Elem(), "(*"+x+")")
+		}
+		return g.encodeValue(f.typ, x)
+	}
+
+	var err error
+	switch {
+	case f.Nullable && nilable(f.typ):
+		g.printf("if %s == nil {\n", x)
+		g.call("n, err", "c.WriteNull(w)")
+		g.printf("} else {\n")
+		if !carriesNull(f.DecoderCodec(), f.typ) {
+			g.call("n, err", "c.WriteNullableSize(0, w)")
+		}
+		err = encode()
+		g.printf("}\n")
+	case f.Nullable:
+		if !carriesNull(f.DecoderCodec(), f.typ) {
+			g.call("n, err", "c.WriteNullableSize(0, w)")
+		}
+		err = encode()
+	default:
+		err = encode()
+	}
+
+	if gate != "" {
+		g.printf("}\n")
+	}
+	g.printf("\n")
+
+	return err
+}
+
+// encodeCodec encodes x with the named codec. Like the Encoder,
+// it hands a nil pointer over as a pointer to the zero value.
+func (g *generator) encodeCodec(codec, args string, t types.Type, x string) {
+
+	g.useRas()
+
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		v := g.tmp("p")
+		g.printf("%s := %s\nif %s == nil {\n%s = new(%s)\n}\n", v, x, v, v, g.typ(p.Elem()))
+		x = v
+	}
+
+	g.call("n, err", "ras.EncodeValue(%q, w, %s%s)", codec, x, args)
+}
+
+// encodeValue encodes the addressable value x of type t the way the Encoder does.
+func (g *generator) encodeValue(t types.Type, x string) error {
+
+	switch {
+	case isTime(t):
+		g.call("n, err", "c.WriteTime(%s, w)", value(x))
+		return nil
+	case g.generating(t) || hasMethod(t, "MarshalRAS"):
+		g.call("n, err", "%s.MarshalRAS(w, version)", operand(x))
+		return nil
+	case hasMethod(t, "FormatRAS"):
+		data := g.tmp("data")
+		g.printf("%s, err := %s.FormatRAS(version)\nif err != nil {\nreturn total, err\n}\n", data, operand(x))
+		g.call("n, err", "w.Write(%s)", data)
+		return nil
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		// Outside of a nullable field nil is written as the zero value.
+		v := g.tmp("p")
+		g.printf("%s := %s\nif %s == nil {\n%s = new(%s)\n}\n", v, x, v, v, g.typ(u.Elem()))
+		return g.encodeValue(u.Elem(), "(*"+v+")")
+
+	case *types.Slice:
+		g.call("n, err", "c.WriteSize(len(%s), w)", x)
+		i := g.tmp("i")
+		g.printf("for %s := range %s {\n", i, x)
+		if err := g.encodeValue(u.Elem(), x+"["+i+"]"); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+
+	case *types.Struct:
+		if err := namedStruct(t, "MarshalRAS"); err != nil {
+			return err
+		}
+		fields, err := g.structFields(t)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if err := g.encodeField("", f, x+"."+f.path); err != nil {
+				return fmt.Errorf("%s: %w", f.path, err)
+			}
+		}
+		return nil
+
+	case *types.Basic:
+		b, ok := basics[u.Kind()]
+		if !ok {
+			return fmt.Errorf("unsupported type %s", t)
+		}
+		g.call("n, err", "c.%s(%s, w)", b.write, convert(t, b.writeType, value(x)))
+		return nil
+	}
+
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+func (g *generator) decodeField(typeName string, f field, x string) error {
+
+	gate := versionGate(f)
+	if gate != "" {
+		g.printf("if %s {\n", gate)
+	}
+
+	decode := func() error {
+		if codec := f.DecoderCodec(); codec != "" {
+			g.decodeCodec(codec, codecArgs(typeName, f), f.typ, x)
+			return nil
+		}
+		return g.decodeValue(f.typ, x)
+	}
+
+	var err error
+	if f.Nullable {
+		g.useRas()
+		null := g.tmp("null")
+		g.printf("var %s bool\n", null)
+		g.call(null+", n, err", "ras.ReadNull(r, %t)", carriesNull(f.DecoderCodec(), f.typ))
+		g.printf("if %s {\n%s = %s\n} else {\n", null, x, g.zero(f.typ))
+		err = decode()
+		g.printf("}\n")
+	} else {
+		err = decode()
+	}
+
+	if gate != "" {
+		g.printf("}\n")
+	}
+	g.printf("\n")
+
+	return err
+}
+
+// decodeCodec decodes into x with the named codec.
+// A pointer is set to a new value once it is decoded.
+func (g *generator) decodeCodec(codec, args string, t types.Type, x string) {
+
+	g.useRas()
+
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		v := g.tmp("p")
+		g.printf("%s := new(%s)\n", v, g.typ(p.Elem()))
+		g.call("n, err", "ras.DecodeValue(%q, r, %s%s)", codec, v, args)
+		g.printf("%s = %s\n", x, v)
+		return
+	}
+
+	g.call("n, err", "ras.DecodeValue(%q, r, %s%s)", codec, addr(x), args)
+}
+
+// decodeValue decodes into the addressable value x of type t the way the Decoder does.
+func (g *generator) decodeValue(t types.Type, x string) error {
+
+	switch {
+	case isTime(t) || isTimestamp(t):
+		g.call("n, err", "c.ReadTimePtr(%s, r)", addr(x))
+		return nil
+	case g.generating(t) || hasMethod(t, "UnmarshalRAS"):
+		g.call("n, err", "%s.UnmarshalRAS(r, version)", operand(x))
+		return nil
+	case hasMethod(t, "ParseRAS"):
+		return fmt.Errorf("%s has ParseRAS only, which needs the buffered input", t)
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", x, x, g.typ(u.Elem()))
+		return g.decodeValue(u.Elem(), "(*"+x+")")
+
+	case *types.Slice:
+		g.useRas()
+		size := g.tmp("size")
+		g.printf("var %s int\n", size)
+		g.call(size+", n, err", "ras.DecodeLen(r)")
+
+		// Like the Decoder, reuse the memory of the slice,
+		// but tell an empty list from an absent one.
+		g.printf("%s = %s[:0]\nif %s == nil {\n%s = %s{}\n}\n", x, x, x, x, g.typ(t))
+
+		i, elem := g.tmp("i"), g.tmp("elem")
+		g.printf("for %s := 0; %s < %s; %s++ {\n", i, i, size, i)
+		g.printf("var %s %s\n%s = append(%s, %s)\n", elem, g.typ(u.Elem()), x, x, elem)
+		if err := g.decodeValue(u.Elem(), x+"["+i+"]"); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+
+	case *types.Struct:
+		if err := namedStruct(t, "UnmarshalRAS"); err != nil {
+			return err
+		}
+		fields, err := g.structFields(t)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if err := g.decodeField("", f, x+"."+f.path); err != nil {
+				return fmt.Errorf("%s: %w", f.path, err)
+			}
+		}
+		return nil
+
+	case *types.Basic:
+		b, ok := basics[u.Kind()]
+		if !ok {
+			return fmt.Errorf("unsupported type %s", t)
+		}
+
+		if b.readVia == "" {
+			g.call("n, err", "c.%s(%s, r)", b.read, convert(t, "*"+b.writeType, addr(x)))
+			return nil
+		}
+
+		v := g.tmp("u")
+		g.printf("var %s %s\n", v, b.readVia)
+		g.call("n, err", "c.%s(&%s, r)", b.read, v)
+		value := u.Name() + "(" + v + ")"
+		if !types.Identical(t, u) {
+			value = g.typ(t) + "(" + value + ")"
+		}
+		g.printf("%s = %s\n", x, value)
+		return nil
+	}
+
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+// pointer returns p if the expression x is (*p).
+func pointer(x string) (string, bool) {
+
+	if !strings.HasPrefix(x, "(*") || !strings.HasSuffix(x, ")") || strings.Count(x, "(") != 1 {
+		return "", false
+	}
+
+	return x[2 : len(x)-1], true
+}
+
+// addr returns the address of the expression x.
+func addr(x string) string {
+
+	if p, ok := pointer(x); ok {
+		return p
+	}
+
+	return "&" + x
+}
+
+// value returns the expression x as an argument.
+func value(x string) string {
+
+	if p, ok := pointer(x); ok {
+		return "*" + p
+	}
+
+	return x
+}
+
+// operand returns the expression x as the operand of a method call,
+// which dereferences a pointer by itself.
+func operand(x string) string {
+
+	if p, ok := pointer(x); ok {
+		return p
+	}
+
+	return x
+}
+
+// zero returns the zero value of t.
+func (g *generator) zero(t types.Type) string {
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		}
+		return "0"
+	case *types.Struct, *types.Array:
+		return g.typ(t) + "{}"
+	}
+
+	return "nil"
+}
+
+// basic names the CodecWriter and CodecReader methods of a basic kind.
+type basic struct {
+	write     string
+	writeType string
+	read      string
+	readVia   string // unsigned type read into, if the kind has no reader of its own
+}
+
+var basics = map[types.BasicKind]basic{
+	types.String:  {"WriteString", "string", "ReadStringPtr", ""},
+	types.Bool:    {"WriteBool", "bool", "ReadBoolPtr", ""},
+	types.Int:     {"WriteInt", "int", "ReadIntPtr", ""},
+	types.Uint:    {"WriteUint", "uint", "ReadUintPtr", ""},
+	types.Int8:    {"WriteByte", "byte", "ReadBytePtr", "byte"},
+	types.Uint8:   {"WriteByte", "byte", "ReadBytePtr", ""},
+	types.Int16:   {"WriteInt16", "int16", "ReadUint16Ptr", "uint16"},
+	types.Uint16:  {"WriteUint16", "uint16", "ReadUint16Ptr", ""},
+	types.Int32:   {"WriteInt32", "int32", "ReadInt32Ptr", ""},
+	types.Uint32:  {"WriteUint32", "uint32", "ReadUint32Ptr", ""},
+	types.Int64:   {"WriteInt64", "int64", "ReadInt64Ptr", ""},
+	types.Uint64:  {"WriteUint64", "uint64", "ReadUint64Ptr", ""},
+	types.Float32: {"WriteFloat32", "float32", "ReadFloat32Ptr", ""},
+	types.Float64: {"WriteFloat64", "float64", "ReadFloat64Ptr", ""},
+}
+
+// convert converts the expression x of type t to the type named to,
+// or to a pointer to it, unless t is already that type.
+func convert(t types.Type, to, x string) string {
+
+	name := strings.TrimPrefix(to, "*")
+	target := types.Universe.Lookup(name).Type()
+	if strings.HasPrefix(to, "*") {
+		t, target = types.NewPointer(t), types.NewPointer(target)
+	}
+
+	if types.Identical(t, target) {
+		return x
+	}
+
+	if strings.HasPrefix(to, "*") {
+		return "(" + to + ")(" + x + ")"
+	}
+
+	return to + "(" + x + ")"
+}
+
+// namedStruct returns an error for a named struct type without the method,
+// since its fields are coded by its own methods.
+func namedStruct(t types.Type, method string) error {
+
+	if _, ok := t.(*types.Named); !ok {
+		return nil
+	}
+
+	if isTimestamp(t) {
+		return fmt.Errorf("%s needs the time codec", t)
+	}
+
+	return fmt.Errorf("%s has no %s method, add it to -type", t, method)
+}
+
+// versionGate returns the condition on the protocol version
+// for the field to be coded, if any.
+func versionGate(f field) string {
+
+	var conds []string
+	if f.Version > 0 {
+		conds = append(conds, fmt.Sprintf("version >= %d", f.Version))
+	}
+	if f.Removed > 0 {
+		conds = append(conds, fmt.Sprintf("version < %d", f.Removed))
+	}
+
+	return strings.Join(conds, " && ")
+}
+
+// nilable reports whether values of t can be nil.
+func nilable(t types.Type) bool {
+
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Interface:
+		return true
+	}
+
+	return false
+}
+
+// carriesNull follows the ras package: the value of a nullable field
+// with these codecs carries the null marker itself.
+func carriesNull(codec string, t types.Type) bool {
+
+	switch codec {
+	case "string", "null-size", "nullable":
+		return true
+	case "":
+		for {
+			p, ok := t.Underlying().(*types.Pointer)
+			if !ok {
+				break
+			}
+			t = p.Elem()
+		}
+		b, ok := t.Underlying().(*types.Basic)
+		return ok && b.Kind() == types.String
+	}
+
+	return false
+}
+
+// receiver returns the receiver name of the methods of the type,
+// avoiding the names of the generated variables.
+func receiver(typeName string) string {
+
+	name := strings.ToLower(typeName[:1])
+	switch name {
+	case "c", "w", "r", "n", "p", "i", "u":
+		return "m"
+	}
+
+	return name
+}
@@ -0,0 +1,223 @@
+// Package rasgen generates MarshalRAS, UnmarshalRAS and SizeRAS methods for
+// structs tagged for the ras package. The generated methods write the same
+// bytes as the reflective Encoder and read them back without reflection.
+package rasgen
+
+import (
+	"fmt"
+	"github.com/v8platform/encoder/ras"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const rasPath = "github.com/v8platform/encoder/ras"
+
+// field is a struct field in wire order, with the fields of embedded
+// structs flattened into their parent as the ras package does.
+type field struct {
+	ras.CodecField
+	path  string // selector from the receiver, such as Header.UUID
+	typ   types.Type
+	order []int
+}
+
+// load type-checks the Go package in dir, leaving out the file skip,
+// which is the output of a previous run.
+func load(dir, skip string) (*types.Package, error) {
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi fs.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != filepath.Base(skip)
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("rasgen: %d packages in %s", len(pkgs), dir)
+	}
+
+	var files []*ast.File
+	var name string
+	for pkgName, pkg := range pkgs {
+		name = pkgName
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return fset.File(files[i].Pos()).Name() < fset.File(files[j].Pos()).Name()
+	})
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(name, fset, files, nil)
+}
+
+// structFields returns the coded fields of the struct type t in wire order.
+func (g *generator) structFields(t types.Type) ([]field, error) {
+
+	st := t.Underlying().(*types.Struct)
+	fields, err := g.collectFields(st, "", nil, 0, ras.CodecField{}, map[types.Type]bool{t: true})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return lessOrder(fields[i].order, fields[j].order)
+	})
+
+	return fields, nil
+}
+
+// collectFields follows getCodecFields of the ras package.
+func (g *generator) collectFields(st *types.Struct, prefix string, order []int, shift int, parent ras.CodecField, visited map[types.Type]bool) ([]field, error) {
+
+	var fields []field
+
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		structTag := reflect.StructTag(st.Tag(i))
+
+		namespace := ras.RasTagNamespace
+		tag, ok := structTag.Lookup(namespace)
+		if !ok {
+			namespace = ras.TagNamespace
+			tag = structTag.Get(namespace)
+		}
+
+		_, isPtr := v.Type().(*types.Pointer)
+		if !v.Exported() && (!v.Embedded() || isPtr) {
+			continue
+		}
+
+		codecField, err := ras.ParseTag(namespace, tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", v.Name(), err)
+		}
+		codecField.Name = v.Name()
+
+		f := field{
+			CodecField: codecField,
+			path:       prefix + v.Name(),
+			typ:        v.Type(),
+			order:      append(append([]int{}, order...), shift+codecField.Number),
+		}
+		if f.Version < parent.Version {
+			f.Version = parent.Version
+		}
+		if parent.Removed != 0 && (f.Removed == 0 || f.Removed > parent.Removed) {
+			f.Removed = parent.Removed
+		}
+
+		if embedded, ok := g.flattened(v, f.CodecField); ok && !visited[embedded] {
+			if isPtr {
+				return nil, fmt.Errorf("field %s: embedded pointers are not supported", v.Name())
+			}
+
+			visited[embedded] = true
+
+			innerOrder, innerShift := f.order, 0
+			if f.HasOffset() {
+				innerOrder, innerShift = order, shift+f.Offset
+			}
+
+			inner, err := g.collectFields(embedded.Underlying().(*types.Struct),
+				f.path+".", innerOrder, innerShift, f.CodecField, visited)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, inner...)
+
+			delete(visited, embedded)
+			continue
+		}
+
+		if f.Ignore {
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// flattened returns the struct type of an embedded field whose fields
+// are coded as fields of the parent. A type that is being generated
+// is not flattened, since it is going to have its own methods.
+func (g *generator) flattened(v *types.Var, f ras.CodecField) (types.Type, bool) {
+
+	if !v.Embedded() || f.Ignore || f.EncoderCodec() != "" || f.DecoderCodec() != "" {
+		return nil, false
+	}
+
+	t := v.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+
+	if _, ok := t.Underlying().(*types.Struct); !ok || isTime(t) || isTimestamp(t) {
+		return nil, false
+	}
+
+	if g.generating(t) {
+		return nil, false
+	}
+
+	for _, name := range []string{"MarshalRAS", "FormatRAS", "UnmarshalRAS", "ParseRAS"} {
+		if hasMethod(t, name) {
+			return nil, false
+		}
+	}
+
+	return t, true
+}
+
+func lessOrder(a, b []int) bool {
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+
+	return len(a) < len(b)
+}
+
+// hasMethod reports whether t or a pointer to t has the method.
+func hasMethod(t types.Type, name string) bool {
+
+	if _, ok := t.(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+
+	return types.NewMethodSet(t).Lookup(nil, name) != nil
+}
+
+func isNamed(t types.Type, path, name string) bool {
+
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	return named.Obj().Pkg().Path() == path && named.Obj().Name() == name
+}
+
+func isTime(t types.Type) bool {
+	return isNamed(t, "time", "Time")
+}
+
+func isTimestamp(t types.Type) bool {
+	return isNamed(t, "google.golang.org/protobuf/types/known/timestamppb", "Timestamp")
+}
@@ -0,0 +1,36 @@
+package rasgen
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate_Golden(t *testing.T) {
+
+	output := filepath.Join("sample", "sample_ras.go")
+
+	got, err := Generate("sample", []string{"Session", "Lock", "Header"}, output)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	want, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("Generate() differs from %s, run go generate in sample:\n%s", output, got)
+	}
+}
+
+func TestGenerate_MissingType(t *testing.T) {
+
+	_, err := Generate("sample", []string{"Session"}, filepath.Join("sample", "sample_ras.go"))
+	if err == nil || !strings.Contains(err.Error(), "Lock has no MarshalRAS method") {
+		t.Errorf("Generate() error = %v, want Lock has no MarshalRAS method", err)
+	}
+}
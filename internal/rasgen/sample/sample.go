@@ -0,0 +1,52 @@
+// Package sample holds types coded by methods generated by rasgen.
+// The generated file is also the golden file of the rasgen tests.
+package sample
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+//go:generate go run ../../../cmd/rasgen -type Session,Lock,Header -output sample_ras.go
+
+type Kind int16
+
+type Header struct {
+	UUID uuid.UUID `rac:"uuid,1"`
+	Name string    `rac:",2"`
+}
+
+type Lock struct {
+	UUID string `rac:"uuid,1"`
+	ID   int    `rac:",2"`
+	Msg  string `rac:",3"`
+}
+
+type Info struct {
+	Host string `rac:",1"`
+	Port uint16 `rac:",2"`
+}
+
+type Session struct {
+	Info      `rac:",offset=20"` // Host is number 21, Port is number 22
+	ID        int32              `rac:",2"`
+	AppID     string             `rac:",3"`
+	Started   time.Time          `rac:",4"`
+	Kind      Kind               `rac:",5"`
+	Level     int8               `rac:",6"`
+	Note      *string            `rac:",7,nullable"`
+	Port      *int32             `rac:",8,nullable"`
+	Locks     []*Lock            `rac:",9"`
+	Tags      []string           `rac:",10"`
+	License   string             `rac:",11,version=4,removed=9"`
+	Memory    int64              `rac:"int64,12,version=10"`
+	Ratio     float64            `rac:",13"`
+	Hibernate bool               `rac:",14"`
+	Owner     *Header            `rac:",15"`
+	Comment   string             `rac:"string,16,trim"`
+	Limits    struct {
+		Min uint16 `rac:",1"`
+		Max uint32 `rac:",2"`
+	} `rac:",17"`
+	Count uint `rac:",18"`
+}
@@ -0,0 +1,514 @@
+// Code generated by rasgen. DO NOT EDIT.
+
+package sample
+
+import (
+	"github.com/v8platform/encoder/ras"
+	"io"
+)
+
+var rasSessionCommentOptions = map[string]string{
+	"trim": "",
+}
+
+// MarshalRAS writes Session in the protocol version.
+func (s *Session) MarshalRAS(w io.Writer, version int) (int, error) {
+
+	c := ras.NewCodecWriter()
+
+	var total int
+	var n int
+	var err error
+
+	n, err = c.WriteInt32(s.ID, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteString(s.AppID, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteTime(s.Started, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteInt16(int16(s.Kind), w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteByte(byte(s.Level), w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	if s.Note == nil {
+		n, err = c.WriteNull(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	} else {
+		n, err = c.WriteString(*s.Note, w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if s.Port == nil {
+		n, err = c.WriteNull(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	} else {
+		n, err = c.WriteNullableSize(0, w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		n, err = c.WriteInt32(*s.Port, w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	n, err = c.WriteSize(len(s.Locks), w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	for i := range s.Locks {
+		p := s.Locks[i]
+		if p == nil {
+			p = new(Lock)
+		}
+		n, err = p.MarshalRAS(w, version)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	n, err = c.WriteSize(len(s.Tags), w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	for i1 := range s.Tags {
+		n, err = c.WriteString(s.Tags[i1], w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if version >= 4 && version < 9 {
+		n, err = c.WriteString(s.License, w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if version >= 10 {
+		n, err = ras.EncodeValue("int64", w, s.Memory)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	n, err = c.WriteFloat64(s.Ratio, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteBool(s.Hibernate, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	p1 := s.Owner
+	if p1 == nil {
+		p1 = new(Header)
+	}
+	n, err = p1.MarshalRAS(w, version)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = ras.EncodeValue("string", w, s.Comment, rasSessionCommentOptions)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteUint16(s.Limits.Min, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteUint32(s.Limits.Max, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteUint(s.Count, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteString(s.Info.Host, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteUint16(s.Info.Port, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// UnmarshalRAS reads Session in the protocol version.
+func (s *Session) UnmarshalRAS(r io.Reader, version int) (int, error) {
+
+	c := ras.NewCodecReader()
+
+	var total int
+	var n int
+	var err error
+
+	n, err = c.ReadInt32Ptr(&s.ID, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadStringPtr(&s.AppID, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadTimePtr(&s.Started, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	var u uint16
+	n, err = c.ReadUint16Ptr(&u, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	s.Kind = Kind(int16(u))
+
+	var u1 byte
+	n, err = c.ReadBytePtr(&u1, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	s.Level = int8(u1)
+
+	var null bool
+	null, n, err = ras.ReadNull(r, true)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	if null {
+		s.Note = nil
+	} else {
+		if s.Note == nil {
+			s.Note = new(string)
+		}
+		n, err = c.ReadStringPtr(s.Note, r)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	var null1 bool
+	null1, n, err = ras.ReadNull(r, false)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	if null1 {
+		s.Port = nil
+	} else {
+		if s.Port == nil {
+			s.Port = new(int32)
+		}
+		n, err = c.ReadInt32Ptr(s.Port, r)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	var size int
+	size, n, err = ras.DecodeLen(r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	s.Locks = s.Locks[:0]
+	if s.Locks == nil {
+		s.Locks = []*Lock{}
+	}
+	for i := 0; i < size; i++ {
+		var elem *Lock
+		s.Locks = append(s.Locks, elem)
+		if s.Locks[i] == nil {
+			s.Locks[i] = new(Lock)
+		}
+		n, err = s.Locks[i].UnmarshalRAS(r, version)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	var size1 int
+	size1, n, err = ras.DecodeLen(r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+	s.Tags = s.Tags[:0]
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	for i1 := 0; i1 < size1; i1++ {
+		var elem1 string
+		s.Tags = append(s.Tags, elem1)
+		n, err = c.ReadStringPtr(&s.Tags[i1], r)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if version >= 4 && version < 9 {
+		n, err = c.ReadStringPtr(&s.License, r)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if version >= 10 {
+		n, err = ras.DecodeValue("int64", r, &s.Memory)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	n, err = c.ReadFloat64Ptr(&s.Ratio, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadBoolPtr(&s.Hibernate, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	if s.Owner == nil {
+		s.Owner = new(Header)
+	}
+	n, err = s.Owner.UnmarshalRAS(r, version)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = ras.DecodeValue("string", r, &s.Comment, rasSessionCommentOptions)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadUint16Ptr(&s.Limits.Min, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadUint32Ptr(&s.Limits.Max, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadUintPtr(&s.Count, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadStringPtr(&s.Info.Host, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadUint16Ptr(&s.Info.Port, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// SizeRAS returns the number of bytes MarshalRAS writes.
+func (s *Session) SizeRAS(version int) (int, error) {
+	return s.MarshalRAS(io.Discard, version)
+}
+
+// MarshalRAS writes Lock in the protocol version.
+func (l *Lock) MarshalRAS(w io.Writer, version int) (int, error) {
+
+	c := ras.NewCodecWriter()
+
+	var total int
+	var n int
+	var err error
+
+	n, err = ras.EncodeValue("uuid", w, l.UUID)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteInt(l.ID, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteString(l.Msg, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// UnmarshalRAS reads Lock in the protocol version.
+func (l *Lock) UnmarshalRAS(r io.Reader, version int) (int, error) {
+
+	c := ras.NewCodecReader()
+
+	var total int
+	var n int
+	var err error
+
+	n, err = ras.DecodeValue("uuid", r, &l.UUID)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadIntPtr(&l.ID, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadStringPtr(&l.Msg, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// SizeRAS returns the number of bytes MarshalRAS writes.
+func (l *Lock) SizeRAS(version int) (int, error) {
+	return l.MarshalRAS(io.Discard, version)
+}
+
+// MarshalRAS writes Header in the protocol version.
+func (h *Header) MarshalRAS(w io.Writer, version int) (int, error) {
+
+	c := ras.NewCodecWriter()
+
+	var total int
+	var n int
+	var err error
+
+	n, err = ras.EncodeValue("uuid", w, h.UUID)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteString(h.Name, w)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// UnmarshalRAS reads Header in the protocol version.
+func (h *Header) UnmarshalRAS(r io.Reader, version int) (int, error) {
+
+	c := ras.NewCodecReader()
+
+	var total int
+	var n int
+	var err error
+
+	n, err = ras.DecodeValue("uuid", r, &h.UUID)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.ReadStringPtr(&h.Name, r)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// SizeRAS returns the number of bytes MarshalRAS writes.
+func (h *Header) SizeRAS(version int) (int, error) {
+	return h.MarshalRAS(io.Discard, version)
+}
@@ -0,0 +1,101 @@
+package sample
+
+import (
+	"bytes"
+	uuid "github.com/satori/go.uuid"
+	"github.com/v8platform/encoder/ras"
+	"testing"
+	"time"
+)
+
+// reflective has the fields of Session but not its methods,
+// so the Encoder codes it by reflection.
+type reflective Session
+
+func TestSession_SameAsEncoder(t *testing.T) {
+
+	note := "note"
+	port := int32(1541)
+
+	src := Session{
+		Info:      Info{Host: "srv", Port: 1545},
+		ID:        42,
+		AppID:     "1CV8C",
+		Started:   time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Kind:      -3,
+		Level:     -1,
+		Note:      &note,
+		Port:      &port,
+		Locks:     []*Lock{{UUID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", ID: 7, Msg: "msg"}, nil},
+		Tags:      []string{"a", ""},
+		License:   "lic",
+		Memory:    1 << 40,
+		Ratio:     0.5,
+		Hibernate: true,
+		Owner:     &Header{UUID: uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), Name: "admin"},
+		Comment:   "comment",
+		Count:     3000000000,
+	}
+	src.Limits.Min, src.Limits.Max = 1, 2
+
+	for _, version := range []int{1, 5, 10} {
+
+		want, err := ras.Encode((*reflective)(&src), version)
+		if err != nil {
+			t.Fatalf("version %d: Encode(reflective) error = %v", version, err)
+		}
+
+		got, err := ras.Encode(&src, version)
+		if err != nil {
+			t.Fatalf("version %d: Encode() error = %v", version, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("version %d: MarshalRAS() = %v, want %v", version, got, want)
+		}
+
+		if size, err := src.SizeRAS(version); err != nil || size != len(want) {
+			t.Errorf("version %d: SizeRAS() = %d, %v, want %d", version, size, err, len(want))
+		}
+
+		var decoded, reflDecoded Session
+		if _, err := ras.Decode(want, &decoded, version); err != nil {
+			t.Fatalf("version %d: Decode() error = %v", version, err)
+		}
+		if _, err := ras.Decode(want, (*reflective)(&reflDecoded), version); err != nil {
+			t.Fatalf("version %d: Decode(reflective) error = %v", version, err)
+		}
+
+		again, err := ras.Encode(&decoded, version)
+		if err != nil || !bytes.Equal(again, want) {
+			t.Errorf("version %d: round trip = %v, %v, want %v", version, again, err, want)
+		}
+
+		reflAgain, err := ras.Encode((*reflective)(&reflDecoded), version)
+		if err != nil || !bytes.Equal(reflAgain, want) {
+			t.Errorf("version %d: reflective round trip = %v, %v, want %v", version, reflAgain, err, want)
+		}
+	}
+}
+
+func TestSession_Null(t *testing.T) {
+
+	src := Session{Started: time.Unix(0, 0).UTC()}
+
+	want, err := ras.Encode((*reflective)(&src), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ras.Encode(&src, 1)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("MarshalRAS() = %v, %v, want %v", got, err, want)
+	}
+
+	decoded := Session{Note: new(string), Port: new(int32)}
+	if _, err := ras.Decode(want, &decoded, 1); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Note != nil || decoded.Port != nil {
+		t.Errorf("Decode() Note = %v, Port = %v, want nil", decoded.Note, decoded.Port)
+	}
+}
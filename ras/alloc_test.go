@@ -0,0 +1,88 @@
+package ras
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"testing"
+	"time"
+)
+
+type benchSession struct {
+	UUID      uuid.UUID     `rac:"uuid,1"`
+	ID        int32         `rac:",2"`
+	AppID     string        `rac:",3"`
+	Started   time.Time     `rac:",4"`
+	Host      string        `rac:",5"`
+	Hibernate bool          `rac:",6"`
+	Bytes     int64         `rac:",7"`
+	CPUTime   int64         `rac:",8"`
+	Memory    int64         `rac:",9"`
+	Licenses  []licenseInfo `rac:",10"`
+}
+
+var benchSrc = benchSession{
+	UUID:     uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+	ID:       42,
+	AppID:    "1CV8C",
+	Started:  time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+	Host:     "srv",
+	Bytes:    1 << 20,
+	Licenses: []licenseInfo{{"rphost", 1560}},
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		buf, err = AppendEncode(buf[:0], &benchSrc, 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeSession(b *testing.B) {
+
+	data, err := Encode(&benchSrc, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	dec := NewDecoder(data)
+	var got benchSession
+	for i := 0; i < b.N; i++ {
+		dec.Reset(data)
+		if _, err := dec.Decode(&got, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAllocs(t *testing.T) {
+
+	data, err := Encode(&benchSrc, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 0, len(data))
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = AppendEncode(buf[:0], &benchSrc, 1)
+	})
+	if allocs > 0 {
+		t.Errorf("AppendEncode allocs = %v, want 0", allocs)
+	}
+
+	dec := NewDecoder(data)
+	var got benchSession
+	allocs = testing.AllocsPerRun(100, func() {
+		dec.Reset(data)
+		_, _ = dec.Decode(&got, 1)
+	})
+	// Only the decoded strings AppID, Host and Licenses[0].Process.
+	if allocs > 3 {
+		t.Errorf("Decode allocs = %v, want at most 3", allocs)
+	}
+}
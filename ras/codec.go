@@ -144,7 +144,7 @@ func (c *codec) ReadSizePtr(val interface{}, reader io.Reader) (n int, err error
 }
 
 func (c *codec) ReadSize(reader io.Reader) (val int, n int, err error) {
-	n, err = c.ReadUuidPtr(&val, reader)
+	n, err = c.ReadSizePtr(&val, reader)
 	return
 }
 
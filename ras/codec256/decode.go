@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	uuid "github.com/satori/go.uuid"
+	encoder "github.com/v8platform/encoder/ras"
 	pb "google.golang.org/protobuf/types/known/timestamppb"
 	"io"
 	"math"
@@ -43,18 +44,8 @@ func ParseBytes(r io.Reader, data []byte) error {
 		return nil
 	}
 
-	readLength := 0
-	n := 0
-	var err error
-
-	for readLength < len(data) {
-
-		n, err = r.Read(data[readLength:])
-		readLength += n
-
-		if err != nil {
-			return err
-		}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return readError("bytes", err)
 	}
 
 	return nil
@@ -63,20 +54,14 @@ func ParseBytes(r io.Reader, data []byte) error {
 func ParseUUID(r io.Reader, into interface{}) error {
 
 	buf := make([]byte, 16)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"uuid",
-			err.Error(),
-		}
+		return readError("uuid", err)
 	}
 
 	u, err := uuid.FromBytes(buf)
 	if err != nil {
-		return &ParseError{
-			"uuid",
-			err.Error(),
-		}
+		return readError("uuid", err)
 	}
 
 	switch typed := into.(type) {
@@ -89,8 +74,7 @@ func ParseUUID(r io.Reader, into interface{}) error {
 	case *uuid.UUID:
 		*typed = u
 	default:
-		return &ParseError{"uuid",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "uuid", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 
 	return nil
@@ -99,12 +83,9 @@ func ParseUUID(r io.Reader, into interface{}) error {
 func ParseTime(r io.Reader, into interface{}) error {
 
 	buf := make([]byte, 8)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"time",
-			err.Error(),
-		}
+		return readError("time", err)
 	}
 
 	val := binary.BigEndian.Uint64(buf)
@@ -123,8 +104,7 @@ func ParseTime(r io.Reader, into interface{}) error {
 	case *pb.Timestamp:
 		*typed = *pb.New(time.Unix(0, timestamp))
 	default:
-		return &ParseError{"time",
-			fmt.Sprintf("Parse time to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "time", Msg: fmt.Sprintf("Parse time to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
@@ -132,12 +112,9 @@ func ParseTime(r io.Reader, into interface{}) error {
 func ParseType(r io.Reader, into interface{}) error {
 
 	buf := make([]byte, 1)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"type",
-			err.Error(),
-		}
+		return readError("type", err)
 	}
 
 	b1 := buf[0]
@@ -147,20 +124,16 @@ func ParseType(r io.Reader, into interface{}) error {
 	case *byte:
 		*typed = cur
 	default:
-		return &ParseError{"type",
-			fmt.Sprintf("Parse type to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "type", Msg: fmt.Sprintf("Parse type to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
 
 func ParseByte(r io.Reader, into interface{}) error {
 	buf := make([]byte, 1)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"byte",
-			err.Error(),
-		}
+		return readError("byte", err)
 	}
 
 	b1 := buf[0]
@@ -175,20 +148,16 @@ func ParseByte(r io.Reader, into interface{}) error {
 	case *int:
 		*typed = int(b1)
 	default:
-		return &ParseError{"byte",
-			fmt.Sprintf("Parse byte to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "byte", Msg: fmt.Sprintf("Parse byte to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
 
 func ParseBool(r io.Reader, into interface{}) error {
 	buf := make([]byte, 1)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"bool",
-			err.Error(),
-		}
+		return readError("bool", err)
 	}
 
 	b1 := buf[0]
@@ -212,8 +181,7 @@ func ParseBool(r io.Reader, into interface{}) error {
 			*typed = 0
 		}
 	default:
-		return &ParseError{"bool",
-			fmt.Sprintf("Parse byte to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "bool", Msg: fmt.Sprintf("Parse byte to <%s> unsupporsed", typed)}
 	}
 	return nil
 
@@ -222,12 +190,9 @@ func ParseBool(r io.Reader, into interface{}) error {
 func ParseShort(r io.Reader, into interface{}) error {
 
 	buf := make([]byte, SIZEOF_SHORT)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"short",
-			err.Error(),
-		}
+		return readError("short", err)
 	}
 
 	val := binary.BigEndian.Uint16(buf)
@@ -248,8 +213,7 @@ func ParseShort(r io.Reader, into interface{}) error {
 	case *int64:
 		*typed = int64(val)
 	default:
-		return &ParseError{"uint16",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "uint16", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 
@@ -257,12 +221,9 @@ func ParseShort(r io.Reader, into interface{}) error {
 
 func ParseInt(r io.Reader, into interface{}) error {
 	buf := make([]byte, SIZEOF_INT)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"int32",
-			err.Error(),
-		}
+		return readError("int32", err)
 	}
 
 	val := binary.BigEndian.Uint32(buf)
@@ -293,8 +254,7 @@ func ParseInt(r io.Reader, into interface{}) error {
 			*typed = true
 		}
 	default:
-		return &ParseError{"int32",
-			fmt.Sprintf("convert to <%s> unsupporsed", reflect.TypeOf(typed))}
+		return &ParseError{Name: "int32", Msg: fmt.Sprintf("convert to <%s> unsupporsed", reflect.TypeOf(typed))}
 	}
 	return nil
 
@@ -302,12 +262,9 @@ func ParseInt(r io.Reader, into interface{}) error {
 
 func ParseLong(r io.Reader, into interface{}) error {
 	buf := make([]byte, SIZEOF_LONG)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"long",
-			err.Error(),
-		}
+		return readError("long", err)
 	}
 
 	val := binary.BigEndian.Uint64(buf)
@@ -328,8 +285,7 @@ func ParseLong(r io.Reader, into interface{}) error {
 	case *int64:
 		*typed = int64(val)
 	default:
-		return &ParseError{"uint64",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "uint64", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 
@@ -337,12 +293,9 @@ func ParseLong(r io.Reader, into interface{}) error {
 
 func ParseFloat(r io.Reader, into interface{}) error {
 	buf := make([]byte, 4)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"float32",
-			err.Error(),
-		}
+		return readError("float32", err)
 	}
 
 	val := math.Float32frombits(binary.BigEndian.Uint32(buf))
@@ -353,8 +306,7 @@ func ParseFloat(r io.Reader, into interface{}) error {
 	case *float64:
 		*typed = float64(val)
 	default:
-		return &ParseError{"float32",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "float32", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
@@ -362,12 +314,9 @@ func ParseFloat(r io.Reader, into interface{}) error {
 func ParseDouble(r io.Reader, into interface{}) error {
 
 	buf := make([]byte, 8)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{
-			"float64",
-			err.Error(),
-		}
+		return readError("float64", err)
 	}
 
 	val := math.Float64frombits(binary.BigEndian.Uint64(buf))
@@ -378,8 +327,7 @@ func ParseDouble(r io.Reader, into interface{}) error {
 	case *float64:
 		*typed = float64(val)
 	default:
-		return &ParseError{"float64",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "float64", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
@@ -393,10 +341,9 @@ func ParseString(r io.Reader, into interface{}) error {
 		return err
 	}
 	buf := make([]byte, size)
-	_, err = r.Read(buf)
+	_, err = io.ReadFull(r, buf)
 	if err != nil {
-		return &ParseError{"string",
-			err.Error()}
+		return readError("string", err)
 	}
 
 	switch typed := into.(type) {
@@ -407,8 +354,7 @@ func ParseString(r io.Reader, into interface{}) error {
 	case []byte:
 		copy(typed, buf)
 	default:
-		return &ParseError{"string",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "string", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 
 	return nil
@@ -418,12 +364,9 @@ func ParseNullable(r io.Reader, into interface{}) error {
 
 	readByte := func(fnName string) (int, byte, error) {
 		buf := make([]byte, 1)
-		n, err := r.Read(buf)
+		n, err := io.ReadFull(r, buf)
 		if err != nil {
-			return n, 0, &ParseError{
-				fnName,
-				err.Error(),
-			}
+			return n, 0, readError(fnName, err)
 		}
 		b1 := buf[0]
 		return n, b1, err
@@ -468,10 +411,7 @@ func ParseNullable(r io.Reader, into interface{}) error {
 	}
 
 	if (cur & 0x7F) != 0x0 {
-		return &ParseError{
-			"nullable",
-			"null expected",
-		}
+		return &ParseError{Name: "nullable", Msg: "unexpected null marker", Err: encoder.ErrNullExpected}
 	}
 
 	return applyNullableS(size, into)
@@ -494,8 +434,7 @@ func applyNullableS(val int, into interface{}) error {
 	case *int64:
 		*typed = int64(val)
 	default:
-		return &ParseError{"nullable",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "nullable", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
@@ -504,12 +443,9 @@ func ParseSize(r io.Reader, into interface{}) error {
 
 	readByte := func(fnName string) (int, byte, error) {
 		buf := make([]byte, 1)
-		n, err := r.Read(buf)
+		n, err := io.ReadFull(r, buf)
 		if err != nil {
-			return n, 0, &ParseError{
-				fnName,
-				err.Error(),
-			}
+			return n, 0, readError(fnName, err)
 		}
 		b1 := buf[0]
 		return n, b1, err
@@ -550,17 +486,21 @@ func ParseSize(r io.Reader, into interface{}) error {
 	case *int64:
 		*typed = int64(size)
 	default:
-		return &ParseError{"size",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &ParseError{Name: "size", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
 
-type ParseError struct {
-	Mame string
-	Msg  string
-}
+// ParseError is the CodecError of a parser.
+type ParseError = encoder.CodecError
+
+// readError reports the failed read of the parser name.
+// The input ending in the middle of a value is io.ErrUnexpectedEOF.
+func readError(name string, err error) error {
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
 
-func (e *ParseError) Error() string {
-	return "ras: (ParserFunc " + e.Mame + ") " + e.Msg + ""
+	return &ParseError{Name: name, Msg: "read", Err: err}
 }
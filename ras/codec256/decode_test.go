@@ -0,0 +1,87 @@
+package ras
+
+import (
+	"bytes"
+	"errors"
+	uuid "github.com/satori/go.uuid"
+	encoder "github.com/v8platform/encoder/ras"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParse_OneByteReader(t *testing.T) {
+
+	u := uuid.NewV4()
+
+	buf := &bytes.Buffer{}
+	for _, err := range []error{
+		FormatUuid(buf, u),
+		FormatLong(buf, int64(1)<<40),
+		FormatDouble(buf, 2.25),
+		FormatString(buf, "кластер"),
+		FormatSize(buf, 300),
+	} {
+		if err != nil {
+			t.Fatalf("Format error = %v", err)
+		}
+	}
+	data := buf.Bytes()
+
+	r := iotest.OneByteReader(bytes.NewReader(data))
+
+	var (
+		gotUUID   uuid.UUID
+		gotLong   int64
+		gotDouble float64
+		gotString string
+		gotSize   int
+	)
+	for _, err := range []error{
+		ParseUUID(r, &gotUUID),
+		ParseLong(r, &gotLong),
+		ParseDouble(r, &gotDouble),
+		ParseString(r, &gotString),
+		ParseSize(r, &gotSize),
+	} {
+		if err != nil {
+			t.Fatalf("Parse error = %v", err)
+		}
+	}
+
+	if gotUUID != u || gotLong != 1<<40 || gotDouble != 2.25 || gotString != "кластер" || gotSize != 300 {
+		t.Errorf("Parse = %s, %d, %v, %q, %d", gotUUID, gotLong, gotDouble, gotString, gotSize)
+	}
+
+	var s string
+	err := ParseString(iotest.OneByteReader(bytes.NewReader(data[16+8+8:len(data)-3])), &s)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ParseString() error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// failWriter fails every write.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestFormat_CodecError(t *testing.T) {
+
+	err := FormatLong(failWriter{}, int64(1))
+
+	var codecErr *encoder.CodecError
+	if !errors.As(err, &codecErr) || !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("FormatLong() error = %v, want *CodecError", err)
+	}
+
+	if want := "ras: long: write: io: read/write on closed pipe"; err.Error() != want {
+		t.Errorf("FormatLong() error = %q, want %q", err.Error(), want)
+	}
+
+	var got int64
+	if err := ParseLong(bytes.NewReader([]byte{1}), &got); !errors.As(err, &codecErr) {
+		t.Errorf("ParseLong() error = %v, want *CodecError", err)
+	}
+}
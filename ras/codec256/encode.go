@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	uuid "github.com/satori/go.uuid"
+	encoder "github.com/v8platform/encoder/ras"
 	pb "google.golang.org/protobuf/types/known/timestamppb"
 	"io"
 	"math"
@@ -27,7 +28,7 @@ func FormatUuid(r io.Writer, value interface{}) error {
 	case *string:
 		return writeBuf("uuid", r, uuid.FromStringOrNil(*val).Bytes())
 	default:
-		return &TypeEncoderError{"uuid", "unknown uuid type"}
+		return &TypeEncoderError{Name: "uuid", Msg: "unknown uuid type"}
 	}
 
 }
@@ -48,7 +49,7 @@ func FormatBytes(r io.Writer, value interface{}) error {
 	case *string:
 		return writeBuf("bytes", r, []byte(*val))
 	default:
-		return &TypeEncoderError{"bytes", "unknown bytes type"}
+		return &TypeEncoderError{Name: "bytes", Msg: "unknown bytes type"}
 	}
 
 }
@@ -74,7 +75,7 @@ func FormatTime(w io.Writer, value interface{}) error {
 	case *pb.Timestamp:
 		val = tVal.AsTime().UnixNano()
 	default:
-		return &TypeEncoderError{"time", fmt.Sprintf("%s", reflect.TypeOf(tVal))}
+		return &TypeEncoderError{Name: "time", Msg: fmt.Sprintf("%s", reflect.TypeOf(tVal))}
 	}
 	ticks := val / int64(time.Millisecond)
 	ticks = ticks*10 + AgeDelta
@@ -120,7 +121,7 @@ func FormatShort(w io.Writer, value interface{}) error {
 	case *uint:
 		val = uint16(*tVal)
 	default:
-		return &TypeEncoderError{"short", fmt.Sprintf("%s", reflect.TypeOf(tVal))}
+		return &TypeEncoderError{Name: "short", Msg: fmt.Sprintf("%s", reflect.TypeOf(tVal))}
 	}
 	buf := make([]byte, SIZEOF_SHORT)
 	binary.BigEndian.PutUint16(buf, val)
@@ -159,7 +160,7 @@ func FormatInt(w io.Writer, value interface{}) error {
 			val = uint32(1)
 		}
 	default:
-		return &TypeEncoderError{"int", "TODO"}
+		return &TypeEncoderError{Name: "int", Msg: "TODO"}
 	}
 	buf := make([]byte, SIZEOF_INT)
 	binary.BigEndian.PutUint32(buf, val)
@@ -180,7 +181,7 @@ func FormatLong(w io.Writer, value interface{}) error {
 	case *uint64:
 		val = uint64(*tVal)
 	default:
-		return &TypeEncoderError{"long", fmt.Sprintf("%s", reflect.TypeOf(tVal))}
+		return &TypeEncoderError{Name: "long", Msg: fmt.Sprintf("%s", reflect.TypeOf(tVal))}
 	}
 	buf := make([]byte, SIZEOF_LONG)
 	binary.BigEndian.PutUint64(buf, val)
@@ -197,7 +198,7 @@ func FormatFloat(w io.Writer, value interface{}) error {
 	case *float32:
 		val = *tVal
 	default:
-		return &TypeEncoderError{"float", "TODO"}
+		return &TypeEncoderError{Name: "float", Msg: "TODO"}
 	}
 	return FormatInt(w, math.Float32bits(val))
 }
@@ -211,7 +212,7 @@ func FormatDouble(w io.Writer, value interface{}) error {
 	case *float64:
 		val = *tVal
 	default:
-		return &TypeEncoderError{"double", "TODO"}
+		return &TypeEncoderError{Name: "double", Msg: "TODO"}
 	}
 	return FormatLong(w, math.Float64bits(val))
 
@@ -230,7 +231,7 @@ func FormatString(w io.Writer, value interface{}) error {
 	case *string:
 		val = []byte(*tVal)
 	default:
-		return &TypeEncoderError{"string", "TODO"}
+		return &TypeEncoderError{Name: "string", Msg: "TODO"}
 	}
 
 	if len(val) == 0 {
@@ -269,7 +270,7 @@ func FormatType(w io.Writer, value interface{}) error {
 	case *uint8:
 		val = byte(*tVal)
 	default:
-		return &TypeEncoderError{"type", "TODO"}
+		return &TypeEncoderError{Name: "type", Msg: "TODO"}
 	}
 
 	if val == NULL_BYTE {
@@ -298,7 +299,7 @@ func FormatBool(w io.Writer, value interface{}) error {
 			val = TRUE_BYTE
 		}
 	default:
-		return &TypeEncoderError{"bool", "TODO"}
+		return &TypeEncoderError{Name: "bool", Msg: "TODO"}
 	}
 
 	return writeBuf("bool", w, []byte{val})
@@ -334,7 +335,7 @@ func FormatByte(w io.Writer, value interface{}) error {
 	case *uint32:
 		val = byte(*tVal)
 	default:
-		return &TypeEncoderError{"byte", "TODO"}
+		return &TypeEncoderError{Name: "byte", Msg: "TODO"}
 	}
 
 	if val == NULL_BYTE {
@@ -427,7 +428,7 @@ func writeBuf(fnName string, w io.Writer, buf []byte) error {
 
 	_, err := w.Write(buf)
 	if err != nil {
-		return &EncoderWriteError{fnName, err}
+		return &EncoderWriteError{Name: fnName, Msg: "write", Err: err}
 	}
 
 	return nil
@@ -462,34 +463,14 @@ func castToInt(fnName string, value interface{}) (int, error) {
 	case *uint64:
 		val = int(*tVal)
 	default:
-		return 0, &TypeEncoderError{fnName, "TODO"}
+		return 0, &TypeEncoderError{Name: fnName, Msg: "TODO"}
 	}
 
 	return val, nil
 }
 
-type EncoderWriteError struct {
-	Mame string
-	err  error
-}
-
-func (e *EncoderWriteError) Error() string {
-
-	return "ras: (FormatFunc " + e.Mame + ") write" + e.err.Error() + ""
-}
+// EncoderWriteError is the CodecError of a failed write.
+type EncoderWriteError = encoder.CodecError
 
-type TypeEncoderError struct {
-	Mame string
-	Msg  string
-}
-
-func (e *TypeEncoderError) Error() string {
-	// if e.Type == nil {
-	// 	return "ras: Decode(nil)"
-	// }
-
-	// if e.Type.Kind() != reflect.Ptr {
-	// 	return "ras: Decode(non-pointer " + e.Type.String() + ")"
-	// }
-	return "ras: (FormatFunc " + e.Mame + ") " + e.Msg + ""
-}
+// TypeEncoderError is the CodecError of a value a formatter cannot write.
+type TypeEncoderError = encoder.CodecError
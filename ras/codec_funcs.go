@@ -0,0 +1,345 @@
+package ras
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// basicCodecs holds the codecs of the basic kinds, as encodeBasic and decodeBasic code them.
+var basicCodecs = map[reflect.Kind]string{
+	reflect.String:  "string",
+	reflect.Bool:    "bool",
+	reflect.Int:     "int",
+	reflect.Uint:    "int",
+	reflect.Int32:   "int32",
+	reflect.Uint32:  "uint32",
+	reflect.Int16:   "int16",
+	reflect.Uint16:  "uint16",
+	reflect.Int64:   "int64",
+	reflect.Uint64:  "uint64",
+	reflect.Int8:    "int8",
+	reflect.Uint8:   "uint8",
+	reflect.Float32: "float32",
+	reflect.Float64: "float64",
+}
+
+// writerEncoders returns the built-in encoders backed by the CodecWriter c.
+func writerEncoders(c CodecWriter) map[string]TypeEncoderFunc {
+
+	encoders := map[string]TypeEncoderFunc{}
+	set := func(names string, fn TypeEncoderFunc) {
+		for _, name := range strings.Fields(names) {
+			encoders[name] = fn
+		}
+	}
+
+	set("time", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		return c.WriteTime(value, w)
+	})
+	set("uuid", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		return c.WriteUuid(value, w)
+	})
+	set("type", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v, err := numberValue("type", value)
+		if err != nil {
+			return 0, err
+		}
+		return c.WriteType(byte(toUint64(v)), w)
+	})
+	set("bool", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v := indirectValue(value)
+		if v.Kind() != reflect.Bool {
+			return 0, &CodecError{Name: "bool", Msg: fmt.Sprintf("encode <%T> unsupported", value)}
+		}
+		return c.WriteBool(v.Bool(), w)
+	})
+	set("byte int8 uint8", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v, err := numberValue("byte", value)
+		if err != nil {
+			return 0, err
+		}
+		return c.WriteByte(byte(toUint64(v)), w)
+	})
+	set("char short int16 uint16", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v, err := numberValue("uint16", value)
+		if err != nil {
+			return 0, err
+		}
+		if isSigned(v.Kind()) {
+			return c.WriteInt16(int16(v.Int()), w)
+		}
+		return c.WriteUint16(uint16(toUint64(v)), w)
+	})
+	set("int int32 uint32", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v, err := numberValue("uint32", value)
+		if err != nil {
+			return 0, err
+		}
+		switch v.Kind() {
+		case reflect.Int:
+			return c.WriteInt(int(v.Int()), w)
+		case reflect.Uint:
+			return c.WriteUint(uint(v.Uint()), w)
+		}
+		if isSigned(v.Kind()) {
+			return c.WriteInt32(int32(v.Int()), w)
+		}
+		return c.WriteUint32(uint32(toUint64(v)), w)
+	})
+	set("int64 uint64 long", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v, err := numberValue("uint64", value)
+		if err != nil {
+			return 0, err
+		}
+		if isSigned(v.Kind()) {
+			return c.WriteInt64(v.Int(), w)
+		}
+		return c.WriteUint64(toUint64(v), w)
+	})
+	set("float32", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v := indirectValue(value)
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return 0, &CodecError{Name: "float32", Msg: fmt.Sprintf("encode <%T> unsupported", value)}
+		}
+		return c.WriteFloat32(float32(v.Float()), w)
+	})
+	set("float64 double", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v := indirectValue(value)
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return 0, &CodecError{Name: "float64", Msg: fmt.Sprintf("encode <%T> unsupported", value)}
+		}
+		return c.WriteFloat64(v.Float(), w)
+	})
+	set("string", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		v := indirectValue(value)
+		switch {
+		case v.Kind() == reflect.String:
+			return c.WriteString(v.String(), w)
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			return c.WriteString(string(v.Bytes()), w)
+		}
+		return 0, &CodecError{Name: "string", Msg: fmt.Sprintf("encode <%T> unsupported", value)}
+	})
+	set("null-size nullable", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		size, err := castToInt("null-size", value)
+		if err != nil {
+			return 0, err
+		}
+		return c.WriteNullableSize(size, w)
+	})
+	set("size", func(w io.Writer, value interface{}, _ ...map[string]string) (int, error) {
+		size, err := castToInt("size", value)
+		if err != nil {
+			return 0, err
+		}
+		return c.WriteSize(size, w)
+	})
+
+	return encoders
+}
+
+// readerDecoders returns the built-in decoders backed by the CodecReader c.
+func readerDecoders(c CodecReader) map[string]TypeDecoderFunc {
+
+	decoders := map[string]TypeDecoderFunc{}
+	set := func(names string, fn TypeDecoderFunc) {
+		for _, name := range strings.Fields(names) {
+			decoders[name] = fn
+		}
+	}
+
+	set("time", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return c.ReadTimePtr(into, r)
+	})
+	set("uuid", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return c.ReadUuidPtr(into, r)
+	})
+	set("size", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return c.ReadSizePtr(into, r)
+	})
+	set("null-size nullable", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return c.ReadNullableSizePtr(into, r)
+	})
+	set("type", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return readNumber("type", into, func() (int64, int, error) {
+			b, n, err := c.ReadType(r)
+			return int64(b), n, err
+		}, nil)
+	})
+	set("bool", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		v, err := intoValue("bool", into, reflect.Bool)
+		if err != nil {
+			return 0, err
+		}
+		b, n, err := c.ReadBool(r)
+		v.SetBool(b)
+		return n, err
+	})
+	set("byte int8 uint8", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return readNumber("byte", into, func() (int64, int, error) {
+			b, n, err := c.ReadByte(r)
+			return int64(int8(b)), n, err
+		}, func() (uint64, int, error) {
+			b, n, err := c.ReadByte(r)
+			return uint64(b), n, err
+		})
+	})
+	set("char short int16 uint16", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return readNumber("uint16", into, func() (int64, int, error) {
+			u, n, err := c.ReadUint16(r)
+			return int64(int16(u)), n, err
+		}, func() (uint64, int, error) {
+			u, n, err := c.ReadUint16(r)
+			return uint64(u), n, err
+		})
+	})
+	set("int int32 uint32", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		switch into := into.(type) {
+		case *int:
+			return c.ReadIntPtr(into, r)
+		case *uint:
+			return c.ReadUintPtr(into, r)
+		}
+		return readNumber("uint32", into, func() (int64, int, error) {
+			i, n, err := c.ReadInt32(r)
+			return int64(i), n, err
+		}, func() (uint64, int, error) {
+			u, n, err := c.ReadUint32(r)
+			return uint64(u), n, err
+		})
+	})
+	set("int64 uint64 long", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		return readNumber("uint64", into, func() (int64, int, error) {
+			return c.ReadInt64(r)
+		}, func() (uint64, int, error) {
+			return c.ReadUint64(r)
+		})
+	})
+	set("float32", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		v, err := intoValue("float32", into, reflect.Float32, reflect.Float64)
+		if err != nil {
+			return 0, err
+		}
+		f, n, err := c.ReadFloat32(r)
+		v.SetFloat(float64(f))
+		return n, err
+	})
+	set("float64 double", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		v, err := intoValue("float64", into, reflect.Float32, reflect.Float64)
+		if err != nil {
+			return 0, err
+		}
+		f, n, err := c.ReadFloat64(r)
+		v.SetFloat(f)
+		return n, err
+	})
+	set("string", func(r io.Reader, into interface{}, _ ...map[string]string) (int, error) {
+		if into, ok := into.(*string); ok {
+			return c.ReadStringPtr(into, r)
+		}
+		v, err := intoValue("string", into, reflect.String, reflect.Slice)
+		if err != nil {
+			return 0, err
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+			return 0, &CodecError{Name: "string", Msg: fmt.Sprintf("decode to <%T> unsupported", into)}
+		}
+		s, n, err := c.ReadString(r)
+		if v.Kind() == reflect.String {
+			v.SetString(s)
+		} else {
+			v.SetBytes([]byte(s))
+		}
+		return n, err
+	})
+
+	return decoders
+}
+
+// indirectValue returns the value held by value, following a pointer.
+func indirectValue(value interface{}) reflect.Value {
+
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// numberValue returns the integer held by value, following a pointer.
+func numberValue(name string, value interface{}) (reflect.Value, error) {
+
+	v := indirectValue(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v, nil
+	}
+
+	return v, &CodecError{Name: name, Msg: fmt.Sprintf("encode <%T> unsupported", value)}
+}
+
+func isSigned(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+// toUint64 returns the bits of the integer v.
+func toUint64(v reflect.Value) uint64 {
+
+	if isSigned(v.Kind()) {
+		return uint64(v.Int())
+	}
+
+	return v.Uint()
+}
+
+// intoValue returns the value into points to, which must be of one of the kinds.
+func intoValue(name string, into interface{}, kinds ...reflect.Kind) (reflect.Value, error) {
+
+	v := reflect.ValueOf(into)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+		for _, kind := range kinds {
+			if v.Kind() == kind {
+				return v, nil
+			}
+		}
+	}
+
+	return v, &CodecError{Name: name, Msg: fmt.Sprintf("decode to <%T> unsupported", into)}
+}
+
+// readNumber reads an integer into the integer pointed to by into, with signed
+// for a signed integer and with unsigned, which defaults to signed, otherwise.
+func readNumber(name string, into interface{}, signed func() (int64, int, error), unsigned func() (uint64, int, error)) (int, error) {
+
+	v, err := intoValue(name, into,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64)
+	if err != nil {
+		return 0, err
+	}
+
+	if isSigned(v.Kind()) || unsigned == nil {
+		i, n, err := signed()
+		if isSigned(v.Kind()) {
+			v.SetInt(i)
+		} else {
+			v.SetUint(uint64(i))
+		}
+		return n, err
+	}
+
+	u, n, err := unsigned()
+	v.SetUint(u)
+	return n, err
+}
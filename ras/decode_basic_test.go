@@ -0,0 +1,85 @@
+package ras
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecoder_Float64(t *testing.T) {
+
+	type value struct {
+		F32 float32 `ras:"1"`
+		F64 float64 `ras:"2"`
+	}
+
+	v := value{F32: 1.5, F64: 1e100}
+
+	data, err := Encode(v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got value
+	if _, err := Decode(data, &got, 1); err != nil || got != v {
+		t.Errorf("Decode() = %+v, %v, want %+v", got, err, v)
+	}
+}
+
+func TestDecoder_NamedBasicTypes(t *testing.T) {
+
+	type (
+		kind  int32
+		name  string
+		flag  bool
+		value struct {
+			Kind kind `ras:"1"`
+			Name name `ras:"2"`
+			Flag flag `ras:"3"`
+		}
+	)
+
+	v := value{Kind: 7, Name: "name", Flag: true}
+
+	data, err := Encode(v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got value
+	if _, err := Decode(data, &got, 1); err != nil || got != v {
+		t.Errorf("Decode() = %+v, %v, want %+v", got, err, v)
+	}
+}
+
+func TestDecoder_Bytes(t *testing.T) {
+
+	type blob struct {
+		Data []byte `ras:"1,decoder=bytes"`
+		Next int32  `ras:"2"`
+	}
+
+	src := blob{[]byte("data"), 7}
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got blob
+	if _, err := DecodeAll(data, &got, 1); err != nil || !reflect.DeepEqual(got, src) {
+		t.Errorf("DecodeAll() = %+v, %v, want %+v", got, err, src)
+	}
+
+	data[1] = 'x'
+	if string(got.Data) != "data" {
+		t.Errorf("DecodeAll() shares the input: %q", got.Data)
+	}
+
+	dec := NewDecoder(data)
+	dec.SetLimits(Limits{MaxStringLen: 3})
+
+	var limitErr *LimitError
+	if _, err := dec.Decode(&got, 1); !errors.As(err, &limitErr) {
+		t.Errorf("Decode() error = %v, want *LimitError", err)
+	}
+}
@@ -8,75 +8,92 @@ import (
 	"io"
 	"math"
 	"reflect"
-	"strings"
 	"time"
 )
 
-var decoderFunc = map[string]TypeDecoderFunc{}
-
 type TypeDecoderFunc func(r io.Reader, into interface{}, opts ...map[string]string) (int, error)
 
-func init() {
-	RegisterDecoderType("time", decodeTime)
-	RegisterDecoderType("type", decodeType)
-	RegisterDecoderType("bool", decodeBool)
-	RegisterDecoderType("byte int8 uint8", decodeByte)
-	RegisterDecoderType("char short int16 uint16", decodeUint16)
-	RegisterDecoderType("int int32 uint32", decodeUint32)
-	RegisterDecoderType("int64 uint64 long", decodeUint64)
-	RegisterDecoderType("float32", decodeFloat32)
-	RegisterDecoderType("float64 double", decodeFloat64)
-	RegisterDecoderType("string", decodeString)
-	RegisterDecoderType("null-size nullable", decodeNullableSize)
-	RegisterDecoderType("size", decodeSize)
-	RegisterDecoderType("bytes", decodeBytes)
-	RegisterDecoderType("uuid", decodeUUID)
+// RegisterDecoderType registers the decoder in the default registry, see Registry.
+func RegisterDecoderType(name string, dec TypeDecoderFunc) {
+	defaultRegistry.RegisterDecoderType(name, dec)
 }
 
-func RegisterDecoderType(name string, dec TypeDecoderFunc) {
+// DecodeValue decodes into with the decoder registered under the name.
+// When r is the reader handed to an Unmarshaler, the decoder is looked up
+// in the registry of the Decoder and backed by its CodecReader, see
+// WithRegistry and WithCodecReader; otherwise the default registry is used.
+func DecodeValue(decoder string, r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	names := strings.Fields(strings.ToLower(name))
+	registry := defaultRegistry
+	rd, fromDecoder := r.(*reader)
+	fromDecoder = fromDecoder && rd.dec != nil
+	if fromDecoder {
+		registry = rd.dec.registry
+	}
 
-	for _, s := range names {
-		decoderFunc[s] = dec
+	typeDecoderFunc, ok := registry.DecoderFunc(decoder)
+	if !ok {
+		return 0, &CodecError{Name: decoder, Msg: "unknown decoder"}
 	}
+
+	if fromDecoder {
+		typeDecoderFunc = rd.dec.fieldDecoder(decoder, typeDecoderFunc)
+	}
+
+	return typeDecoderFunc(r, into, opts...)
 }
 
+// decodeBytes reads a size followed by as many bytes.
 func decodeBytes(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
-	return 0, nil
+
+	size, total, err := readSize(r)
+	if err != nil {
+		return total, err
+	}
+
+	buf, nRead, err := readSized(r, size)
+	total += nRead
+	if err != nil {
+		return total, readError("bytes", err)
+	}
+
+	switch typed := into.(type) {
+	case *[]byte:
+		*typed = append([]byte(nil), buf...)
+	case *string:
+		*typed = string(buf)
+	case []byte:
+		copy(typed, buf)
+	default:
+		return total, &CodecError{Name: "bytes", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+	}
+
+	return total, nil
 }
 
 func decodeUUID(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	buf := make([]byte, 16)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 16)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"uuid",
-			err.Error(),
-		}
+		return n, readError("uuid", err)
 	}
 
 	u, err := uuid.FromBytes(buf)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"uuid",
-			err.Error(),
-		}
+		return n, readError("uuid", err)
 	}
 
 	switch typed := into.(type) {
 	case []byte:
 		copy(typed, buf)
 	case *[]byte:
-		*typed = buf
+		*typed = append([]byte(nil), buf...)
 	case *string:
 		*typed = u.String()
 	case *uuid.UUID:
 		*typed = u
 	default:
-		return n, &TypeDecodeError{"uuid",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "uuid", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 
 	return n, nil
@@ -84,13 +101,9 @@ func decodeUUID(r io.Reader, into interface{}, opts ...map[string]string) (int,
 
 func decodeTime(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	buf := make([]byte, 8)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 8)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"time",
-			err.Error(),
-		}
+		return n, readError("time", err)
 	}
 
 	val := binary.BigEndian.Uint64(buf)
@@ -109,21 +122,16 @@ func decodeTime(r io.Reader, into interface{}, opts ...map[string]string) (int,
 	case *pb.Timestamp:
 		*typed = *pb.New(time.Unix(0, timestamp))
 	default:
-		return n, &TypeDecodeError{"time",
-			fmt.Sprintf("decode time to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "time", Msg: fmt.Sprintf("decode time to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 }
 
 func decodeType(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	buf := make([]byte, 1)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 1)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"type",
-			err.Error(),
-		}
+		return n, readError("type", err)
 	}
 
 	b1 := buf[0]
@@ -133,20 +141,15 @@ func decodeType(r io.Reader, into interface{}, opts ...map[string]string) (int,
 	case *byte:
 		*typed = cur
 	default:
-		return n, &TypeDecodeError{"type",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "type", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 }
 
 func decodeByte(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
-	buf := make([]byte, 1)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 1)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"byte",
-			err.Error(),
-		}
+		return n, readError("byte", err)
 	}
 
 	b1 := buf[0]
@@ -157,20 +160,15 @@ func decodeByte(r io.Reader, into interface{}, opts ...map[string]string) (int,
 	case *int8:
 		*typed = int8(b1)
 	default:
-		return n, &TypeDecodeError{"byte",
-			fmt.Sprintf("decode byte to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "byte", Msg: fmt.Sprintf("decode byte to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 }
 
 func decodeBool(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
-	buf := make([]byte, 1)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 1)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"bool",
-			err.Error(),
-		}
+		return n, readError("bool", err)
 	}
 
 	b1 := buf[0]
@@ -194,8 +192,7 @@ func decodeBool(r io.Reader, into interface{}, opts ...map[string]string) (int,
 			*typed = 0
 		}
 	default:
-		return n, &TypeDecodeError{"bool",
-			fmt.Sprintf("decode byte to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "bool", Msg: fmt.Sprintf("decode byte to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 
@@ -203,13 +200,9 @@ func decodeBool(r io.Reader, into interface{}, opts ...map[string]string) (int,
 
 func decodeUint16(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	buf := make([]byte, 2)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 2)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"uint16",
-			err.Error(),
-		}
+		return n, readError("uint16", err)
 	}
 
 	val := binary.BigEndian.Uint16(buf)
@@ -230,21 +223,16 @@ func decodeUint16(r io.Reader, into interface{}, opts ...map[string]string) (int
 	case *int64:
 		*typed = int64(val)
 	default:
-		return n, &TypeDecodeError{"uint16",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "uint16", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 
 }
 
 func decodeUint32(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
-	buf := make([]byte, 4)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 4)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"uint32",
-			err.Error(),
-		}
+		return n, readError("uint32", err)
 	}
 
 	val := binary.BigEndian.Uint32(buf)
@@ -252,6 +240,8 @@ func decodeUint32(r io.Reader, into interface{}, opts ...map[string]string) (int
 	switch typed := into.(type) {
 	case *int:
 		*typed = int(val)
+	case *uint:
+		*typed = uint(val)
 	case *uint16:
 		*typed = uint16(val)
 	case *int16:
@@ -265,21 +255,16 @@ func decodeUint32(r io.Reader, into interface{}, opts ...map[string]string) (int
 	case *int64:
 		*typed = int64(val)
 	default:
-		return n, &TypeDecodeError{"uint32",
-			fmt.Sprintf("convert to <%s> unsupporsed", reflect.TypeOf(typed))}
+		return n, &CodecError{Name: "uint32", Msg: fmt.Sprintf("convert to <%s> unsupporsed", reflect.TypeOf(typed))}
 	}
 	return n, nil
 
 }
 
 func decodeUint64(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
-	buf := make([]byte, 8)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 8)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"uint64",
-			err.Error(),
-		}
+		return n, readError("uint64", err)
 	}
 
 	val := binary.BigEndian.Uint64(buf)
@@ -300,21 +285,16 @@ func decodeUint64(r io.Reader, into interface{}, opts ...map[string]string) (int
 	case *int64:
 		*typed = int64(val)
 	default:
-		return n, &TypeDecodeError{"uint64",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "uint64", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 
 }
 
 func decodeFloat32(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
-	buf := make([]byte, 4)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 4)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"float32",
-			err.Error(),
-		}
+		return n, readError("float32", err)
 	}
 
 	val := math.Float32frombits(binary.BigEndian.Uint32(buf))
@@ -325,21 +305,16 @@ func decodeFloat32(r io.Reader, into interface{}, opts ...map[string]string) (in
 	case *float64:
 		*typed = float64(val)
 	default:
-		return n, &TypeDecodeError{"float32",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "float32", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 }
 
 func decodeFloat64(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	buf := make([]byte, 8)
-	n, err := r.Read(buf)
+	buf, n, err := readN(r, 8)
 	if err != nil {
-		return n, &TypeDecodeError{
-			"float64",
-			err.Error(),
-		}
+		return n, readError("float64", err)
 	}
 
 	val := math.Float64frombits(binary.BigEndian.Uint64(buf))
@@ -350,79 +325,68 @@ func decodeFloat64(r io.Reader, into interface{}, opts ...map[string]string) (in
 	case *float64:
 		*typed = float64(val)
 	default:
-		return n, &TypeDecodeError{"float64",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return n, &CodecError{Name: "float64", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return n, nil
 }
 
 func decodeString(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
 
-	var size, total int
-
-	n, err := decodeNullableSize(r, &size)
+	size, total, err := readNullableSize(r)
 	if err != nil {
-		return n, err
+		return total, err
 	}
-	total += n
-	buf := make([]byte, size)
-	nRead, err := r.Read(buf)
+
+	buf, nRead, err := readSized(r, size)
 	total += nRead
 	if err != nil {
-		return total, &TypeDecodeError{"string",
-			fmt.Sprintf("read bytes<%d> err: <%s>", n, err.Error())}
+		return total, readError("string", err)
 	}
 
 	switch typed := into.(type) {
 	case *string:
 		*typed = string(buf)
 	case *[]byte:
-		*typed = buf
+		*typed = append([]byte(nil), buf...)
 	case []byte:
 		copy(typed, buf)
 	default:
-		return total, &TypeDecodeError{"string",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return total, &CodecError{Name: "string", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 
 	return total, nil
 }
 
-func decodeNullableSize(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
+// readNullableSize reads a nullable size. NULL_BYTE reads as 0.
+func readNullableSize(r io.Reader) (size int, total int, err error) {
 
 	readByte := func(fnName string) (int, byte, error) {
-		buf := make([]byte, 1)
-		n, err := r.Read(buf)
+		buf, n, err := readN(r, 1)
 		if err != nil {
-			return n, 0, &TypeDecodeError{
-				fnName,
-				err.Error(),
-			}
+			return n, 0, readError(fnName, err)
 		}
 		b1 := buf[0]
 		return n, b1, err
 	}
 
-	size := 0
-	var total int
 	n, b1, err := readByte("nullableSize")
 	total += n
 	if err != nil {
-		return total, err
+		return 0, total, err
 	}
 
 	cur := int(b1 & 0xFF)
 	if (cur & 0xFFFFFF80) == 0x0 {
 		size = cur & 0x3F
 		if cur&0x40 == 0x0 {
-			return total, applyNullableSize(size, into)
+			return size, total, nil
 		}
 
 		shift := NULL_SHIFT
 		n, b1, err := readByte("nullableSize")
 		total += n
 		if err != nil {
-			return total, err
+			return 0, total, err
 		}
 		cur := int(b1 & 0xFF)
 		size += (cur & 0x7F) << NULL_SHIFT
@@ -433,7 +397,7 @@ func decodeNullableSize(r io.Reader, into interface{}, opts ...map[string]string
 			n, b1, err := readByte("nullableSize")
 			total += n
 			if err != nil {
-				return total, err
+				return 0, total, err
 			}
 
 			cur = int(b1 & 0xFF)
@@ -441,17 +405,24 @@ func decodeNullableSize(r io.Reader, into interface{}, opts ...map[string]string
 			shift += MAX_SHIFT
 
 		}
-		return total, applyNullableSize(size, into)
+		return size, total, nil
 	}
 
 	if (cur & 0x7F) != 0x0 {
-		return total, &TypeDecodeError{
-			"nullableSize",
-			"null expected",
-		}
+		return 0, total, &CodecError{Name: "nullableSize", Msg: fmt.Sprintf("unexpected marker 0x%02x", cur), Err: ErrNullExpected}
 	}
 
-	return total, applyNullableSize(size, into)
+	return size, total, nil
+}
+
+func decodeNullableSize(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
+
+	size, n, err := readNullableSize(r)
+	if err != nil {
+		return n, err
+	}
+
+	return n, applyNullableSize(size, into)
 }
 
 func applyNullableSize(val int, into interface{}) error {
@@ -471,42 +442,37 @@ func applyNullableSize(val int, into interface{}) error {
 	case *int64:
 		*typed = int64(val)
 	default:
-		return &TypeDecodeError{"nullableSize",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return &CodecError{Name: "nullableSize", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return nil
 }
 
-func decodeSize(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
+// readSize reads a size.
+func readSize(r io.Reader) (size int, total int, err error) {
 
 	readByte := func(fnName string) (int, byte, error) {
-		buf := make([]byte, 1)
-		n, err := r.Read(buf)
+		buf, n, err := readN(r, 1)
 		if err != nil {
-			return n, 0, &TypeDecodeError{
-				fnName,
-				err.Error(),
-			}
+			return n, 0, readError(fnName, err)
 		}
 		b1 := buf[0]
 		return n, b1, err
 	}
-	var total int
 	ff := 0xFFFFFF80
 	n, b1, err := readByte("size")
 	total += n
 	if err != nil {
-		return total, err
+		return 0, total, err
 	}
 
 	cur := int(b1 & 0xFF)
-	size := cur & 0x7F
+	size = cur & 0x7F
 	for shift := MAX_SHIFT; (cur & ff) != 0x0; {
 
 		n, b1, err = readByte("size")
 		total += n
 		if err != nil {
-			return total, err
+			return 0, total, err
 		}
 
 		cur = int(b1 & 0xFF)
@@ -514,6 +480,16 @@ func decodeSize(r io.Reader, into interface{}, opts ...map[string]string) (int,
 		shift += MAX_SHIFT
 	}
 
+	return size, total, nil
+}
+
+func decodeSize(r io.Reader, into interface{}, opts ...map[string]string) (int, error) {
+
+	size, total, err := readSize(r)
+	if err != nil {
+		return total, err
+	}
+
 	switch typed := into.(type) {
 	case *int:
 		*typed = int(size)
@@ -530,24 +506,26 @@ func decodeSize(r io.Reader, into interface{}, opts ...map[string]string) (int,
 	case *int64:
 		*typed = int64(size)
 	default:
-		return total, &TypeDecodeError{"size",
-			fmt.Sprintf("convert to <%s> unsupporsed", typed)}
+		return total, &CodecError{Name: "size", Msg: fmt.Sprintf("convert to <%s> unsupporsed", typed)}
 	}
 	return total, nil
 }
 
-type TypeDecodeError struct {
-	Mame string
-	Msg  string
-}
+// TypeDecodeError is the former name of CodecError for decoder codecs.
+type TypeDecodeError = CodecError
 
-func (e *TypeDecodeError) Error() string {
-	// if e.Type == nil {
-	// 	return "ras: Decode(nil)"
-	// }
+// readError reports the failed read of the codec name. The input ending
+// in the middle of a value is reported as ErrShortBuffer.
+func readError(name string, err error) error {
+
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		err = ErrShortBuffer
+	}
+
+	if limitErr, ok := err.(*LimitError); ok {
+		return limitErr
+	}
 
-	// if e.Type.Kind() != reflect.Ptr {
-	// 	return "ras: Decode(non-pointer " + e.Type.String() + ")"
-	// }
-	return "ras: (decoderFunc " + e.Mame + ") " + e.Msg + ""
+	return &CodecError{Name: name, Msg: "read", Err: err}
 }
@@ -2,6 +2,7 @@ package ras
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	pb "google.golang.org/protobuf/types/known/timestamppb"
 	"io"
@@ -23,33 +24,118 @@ type Unmarshaler interface {
 }
 
 type Decoder struct {
-	buf *bytes.Buffer
+	r   *reader
 	err error
 	n   int // bytes decoded
+
+	depth            int // nesting of the value being decoded
+	disallowTrailing bool
+
+	version  int                        // see Unmarshal
+	registry *Registry                  // set by WithRegistry
+	codec    CodecReader                // set by WithCodecReader
+	decoders map[string]TypeDecoderFunc // the built-in decoders backed by codec
 }
 
-// NewDecoder create new encoderFunc for version
+// NewDecoderFromReader returns a decoder that reads successive values from r.
 //
-func NewDecoderFromReader(r io.Reader) *Decoder {
+// The decoder reads only the bytes each value needs, so r may be a live
+// connection that carries more data after the value. A Parser may cause
+// bytes to be read ahead; they are kept for the next call to Decode.
+func NewDecoderFromReader(r io.Reader, opts ...Option) *Decoder {
 
-	buf := &bytes.Buffer{}
-	_, err := buf.ReadFrom(r)
-	if err != nil {
-		return nil
+	dec := &Decoder{
+		r: newReader(r, nil),
+	}
+	dec.setOptions(opts)
+
+	return dec
+}
+
+func NewDecoder(b []byte, opts ...Option) *Decoder {
+
+	dec := &Decoder{
+		r: newReader(nil, b),
+	}
+	dec.setOptions(opts)
+
+	return dec
+}
+
+// setOptions applies the options. A CodecReader replaces the built-in
+// codecs of the basic types and sizes and the codecs of the fields tagged
+// with a built-in codec name. Null markers are read by ReadNull, codecs
+// registered with RegisterDecoderType, Unmarshalers and Parsers are used
+// as they are.
+func (dec *Decoder) setOptions(opts []Option) {
+
+	var o CodecOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	return &Decoder{
-		buf: buf,
+	dec.version = o.Version
+	dec.registry = o.Registry
+	if dec.registry == nil {
+		dec.registry = defaultRegistry
 	}
+	dec.codec = o.Reader
+	dec.r.dec = dec
+	dec.decoders = nil
+	if o.Reader != nil {
+		dec.decoders = readerDecoders(o.Reader)
+	}
+}
+
+// Version returns the protocol version Unmarshal decodes in, see WithCodecVersion.
+func (dec *Decoder) Version() int {
+	return dec.version
+}
+
+// Reset makes the decoder decode b from the start, keeping its limits
+// and settings, so that it can be reused without allocating.
+func (dec *Decoder) Reset(b []byte) {
+
+	*dec.r = reader{buf: b, limits: dec.r.limits, dec: dec}
+	dec.err = nil
+	dec.n = 0
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer.
+// The reader is valid until the next call to Decode.
+func (dec *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(dec.r.buf[dec.r.off:])
+}
 
+// Offset returns the number of bytes consumed since the decoder was created.
+func (dec *Decoder) Offset() int {
+	return dec.r.offset
 }
 
-func NewDecoder(b []byte) *Decoder {
+// Remaining returns the number of unread bytes held by the decoder.
+// For a decoder reading from a stream, these are the bytes read ahead only.
+func (dec *Decoder) Remaining() int {
+	return len(dec.r.buf) - dec.r.off
+}
 
-	return &Decoder{
-		buf: bytes.NewBuffer(b),
+// More reports whether there is another value to decode. For a decoder
+// reading from a stream, it waits until a byte arrives or the stream ends.
+func (dec *Decoder) More() bool {
+
+	if dec.Remaining() > 0 {
+		return true
 	}
 
+	_, err := dec.r.peekByte()
+	dec.r.err = nil
+	return err == nil
+}
+
+// DisallowTrailingBytes causes Decode to return an error wrapping
+// ErrTrailingBytes when input is left after the value. For a decoder
+// reading from a stream, the stream must end after the value.
+func (dec *Decoder) DisallowTrailingBytes() {
+	dec.disallowTrailing = true
 }
 
 // An InvalidEncodeError describes an invalid argument passed to Unmarshal.
@@ -69,18 +155,36 @@ func (e *InvalidDecodeError) Error() string {
 	return "ras: Decode(nil " + e.Type.String() + ")"
 }
 
-func Decode(data []byte, v interface{}, version int) (int, error) {
+func Decode(data []byte, v interface{}, version int, opts ...Option) (int, error) {
 
-	decoder := NewDecoder(data)
+	decoder := NewDecoder(data, opts...)
 
 	return decoder.Decode(v, version)
 
 }
 
+// DecodeAll is like Decode, but data must hold exactly one value:
+// bytes left after it are reported as an error wrapping ErrTrailingBytes.
+func DecodeAll(data []byte, v interface{}, version int, opts ...Option) (int, error) {
+
+	decoder := NewDecoder(data, opts...)
+	decoder.DisallowTrailingBytes()
+
+	return decoder.Decode(v, version)
+
+}
+
+// Decode reads the next value from its input and stores it in the value pointed to by val.
+// At the end of the input, Decode returns io.EOF.
+// DefaultVersion stands for the version set by WithCodecVersion.
 func (dec *Decoder) Decode(val interface{}, version int) (int, error) {
 
 	dec.n = 0
 
+	if version == DefaultVersion {
+		version = dec.version
+	}
+
 	if dec.err != nil {
 		return dec.n, dec.err
 	}
@@ -91,8 +195,51 @@ func (dec *Decoder) Decode(val interface{}, version int) (int, error) {
 
 	rValue := reflect.ValueOf(val)
 
-	return dec.n, dec.decodeValue(rValue, version)
+	start := dec.r.offset
+	dec.r.err = nil
+	dec.r.end = start + dec.r.limits.MaxBytes
+	dec.depth = 0
+
+	err := dec.decodeValue(rValue, version)
+	if err != nil {
+		if dec.r.offset == start && dec.r.err == io.EOF {
+			return dec.n, io.EOF
+		}
+		return dec.n, dec.fail(err, typeName(rValue.Type().Elem()), start)
+	}
+
+	if dec.disallowTrailing && dec.More() {
+		return dec.n, dec.trailingError(typeName(rValue.Type().Elem()), start)
+	}
+
+	return dec.n, nil
+
+}
+
+// fail returns err as the *Error of the value at path, whose decoding
+// started at the offset start, and keeps it for later calls.
+func (dec *Decoder) fail(err error, path string, start int) error {
+
+	err = wrapError(err, "decode", path, start, "")
+	if e, ok := err.(*Error); ok {
+		e.Offset -= start
+	}
+
+	dec.err = err
+	return err
+}
 
+// trailingError reports the bytes left after the value at path,
+// whose decoding started at the offset start.
+func (dec *Decoder) trailingError(path string, start int) error {
+
+	err := fmt.Errorf("%w: %d bytes left", ErrTrailingBytes, dec.Remaining())
+	return &Error{Op: "decode", Path: path, Offset: dec.r.offset - start, Err: err}
+}
+
+// Unmarshal is like Decode in the version set by WithCodecVersion.
+func (dec *Decoder) Unmarshal(val interface{}) (int, error) {
+	return dec.Decode(val, dec.version)
 }
 
 func (dec *Decoder) decodeValue(rValue reflect.Value, version int) error {
@@ -103,9 +250,15 @@ func (dec *Decoder) decodeValue(rValue reflect.Value, version int) error {
 		return dec.err
 	}
 
-	rType := rValue.Type()
-	if _, ok := rType.(reflect.Type); !ok {
-		rType = rType.Elem()
+	// An interface is replaced by a value of the registered type,
+	// so indirect must not reuse the value it holds.
+	if rValue.Kind() == reflect.Interface {
+		return dec.decodeInterface(rValue, version)
+	}
+
+	un, parser, rValue := indirect(rValue, false)
+	if un != nil || parser != nil {
+		return dec.decodeUnmarshaler(un, parser, version)
 	}
 
 	if rValue.CanAddr() {
@@ -113,7 +266,7 @@ func (dec *Decoder) decodeValue(rValue reflect.Value, version int) error {
 
 		switch iFace.(type) {
 		case *time.Time, *pb.Timestamp:
-			n, err := decodeTime(dec.buf, iFace)
+			n, err := dec.fieldDecoder("time", decodeTime)(dec.r, iFace)
 			dec.n += n
 			if err != nil {
 				return err
@@ -123,15 +276,26 @@ func (dec *Decoder) decodeValue(rValue reflect.Value, version int) error {
 		}
 	}
 
+	rType := rValue.Type()
 	rKind := rType.Kind()
 
+	switch rKind {
+	case reflect.Struct, reflect.Slice, reflect.Interface:
+		dec.depth++
+		defer func() { dec.depth-- }()
+
+		if err := checkLimit("depth", dec.depth, dec.r.limits.MaxDepth); err != nil {
+			return err
+		}
+	}
+
 	switch rKind {
 	case reflect.Struct:
 		err = dec.decodeStruct(rType, rValue, version)
 	case reflect.Slice:
 		err = dec.decodeSlice(rValue, version)
-	case reflect.Ptr:
-		err = dec.decodePtr(rValue, version)
+	case reflect.Interface:
+		err = dec.decodeInterface(rValue, version)
 	default:
 		err = dec.decodeBasic(rType, rValue)
 	}
@@ -148,6 +312,23 @@ func (dec *Decoder) decodeCustom(v reflect.Value, decodeFn func() interface{}) e
 	return nil
 }
 
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.String:  reflect.TypeOf(""),
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+}
+
 func (dec *Decoder) decodeBasic(rType reflect.Type, v reflect.Value) error {
 
 	rKind := rType.Kind()
@@ -156,13 +337,25 @@ func (dec *Decoder) decodeBasic(rType reflect.Type, v reflect.Value) error {
 		return fmt.Errorf("ras: cannot addr for value: %s", v.String())
 	}
 
-	iFace := v.Addr().Interface()
+	// The codecs know the basic types only, so a value of a named type
+	// is decoded through a pointer to its basic type.
+	ptr := v.Addr()
+	if t, ok := basicTypes[rKind]; ok && rType != t {
+		ptr = ptr.Convert(reflect.PtrTo(t))
+	}
+	iFace := ptr.Interface()
+
+	if name, ok := basicCodecs[rKind]; ok && dec.decoders != nil {
+		n, err := dec.decoders[name](dec.r, iFace)
+		dec.n += n
+		return err
+	}
 
 	switch rKind {
 
 	case reflect.String:
 
-		n, err := decodeString(dec.buf, iFace)
+		n, err := decodeString(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
@@ -170,46 +363,46 @@ func (dec *Decoder) decodeBasic(rType reflect.Type, v reflect.Value) error {
 
 	case reflect.Bool:
 
-		n, err := decodeBool(dec.buf, iFace)
+		n, err := decodeBool(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 
 	case reflect.Int, reflect.Uint, reflect.Int32, reflect.Uint32:
-		n, err := decodeUint32(dec.buf, iFace)
+		n, err := decodeUint32(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 	case reflect.Int16, reflect.Uint16:
-		n, err := decodeUint16(dec.buf, iFace)
+		n, err := decodeUint16(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 	case reflect.Int64, reflect.Uint64:
-		n, err := decodeUint64(dec.buf, iFace)
+		n, err := decodeUint64(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 	case reflect.Int8, reflect.Uint8:
-		n, err := decodeByte(dec.buf, iFace)
+		n, err := decodeByte(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 	case reflect.Float32:
 
-		n, err := decodeFloat32(dec.buf, iFace)
+		n, err := decodeFloat32(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 
 	case reflect.Float64:
-		n, err := decodeFloat32(dec.buf, iFace)
+		n, err := decodeFloat64(dec.r, iFace)
 		dec.n += n
 		if err != nil {
 			return err
@@ -225,117 +418,366 @@ func (dec *Decoder) decodeBasic(rType reflect.Type, v reflect.Value) error {
 
 func (dec *Decoder) decodeStruct(rType reflect.Type, rValue reflect.Value, version int) error {
 
-	fields := getCodecFields(rType)
+	plan := dec.registry.cachedPlan(rType)
+	if plan.err != nil {
+		return plan.err
+	}
+
+	for _, codecField := range plan.fields {
 
-	for _, codecField := range fields {
-		if codecField.Ignore {
+		if !codecField.inVersion(version) {
 			continue
 		}
 
-		if codecField.Version > version {
-			continue
+		start := dec.r.offset
+		if err := dec.decodeField(plan, codecField, rValue, version); err != nil {
+			return wrapError(err, "decode", "."+codecField.Name, start, codecField.DecoderCodec())
 		}
+	}
 
-		f := rValue.Field(codecField.fieldIdx)
+	return nil
+}
 
-		if codecField.codec != "" {
+// decodeField decodes the field of the struct value rValue.
+func (dec *Decoder) decodeField(plan *structPlan, codecField CodecField, rValue reflect.Value, version int) error {
 
-			if typeDecoderFunc, ok := decoderFunc[codecField.codec]; ok {
-				var iFace interface{}
+	f := fieldByIndex(rValue, codecField.index, true)
 
-				if f.Kind() == reflect.Ptr {
-					valType := f.Type()
-					valElemType := valType.Elem()
-					val := reflect.New(valElemType)
-					iFace = val.Interface()
-				} else {
-					iFace = f.Addr().Interface()
-				}
+	if codecField.Nullable {
+		null, err := dec.decodeNull(codecField)
+		if err != nil {
+			return err
+		}
+		if null {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+	}
 
-				n, err := typeDecoderFunc(dec.buf, iFace)
-				dec.n += n
-				if err != nil {
-					return err
-				}
+	if codecField.discrIdx >= 0 {
+		discriminator := fieldByIndex(rValue, plan.fields[codecField.discrIdx].index, true)
+		err := dec.decodeDiscriminated(f, discriminator, version)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
 
-				if f.Kind() == reflect.Ptr {
-					f.Set(reflect.ValueOf(iFace))
-				}
+	if name := codecField.DecoderCodec(); name != "" {
 
-				continue
+		if typeDecoderFunc := dec.fieldDecoder(name, codecField.decodeFn); typeDecoderFunc != nil {
+			var iFace interface{}
+
+			if f.Kind() == reflect.Ptr {
+				valType := f.Type()
+				valElemType := valType.Elem()
+				val := reflect.New(valElemType)
+				iFace = val.Interface()
+			} else {
+				iFace = f.Addr().Interface()
 			}
 
-			return &TypeDecodeError{codecField.codec, "not found codec func"}
+			n, err := typeDecoderFunc(dec.r, iFace, codecField.opts...)
+			dec.n += n
+			if err != nil {
+				return err
+			}
 
+			if f.Kind() == reflect.Ptr {
+				f.Set(reflect.ValueOf(iFace))
+			}
+
+			return nil
 		}
 
-		err := dec.decodeValue(f, version)
+		return &CodecError{Name: name, Msg: "not found codec func"}
+
+	}
+
+	return dec.decodeValue(f, version)
+}
+
+// decodeInterface reads the id of a registered type and then a value of that type.
+func (dec *Decoder) decodeInterface(value reflect.Value, version int) error {
+
+	id, n, err := dec.readSize()
+	dec.n += n
+	if err != nil {
+		return err
+	}
+
+	return dec.decodeRegistered(value, id, version)
+}
+
+// decodeDiscriminated reads the value of an interface field, or the elements of
+// a slice of interfaces, using the type id held by the discriminator field.
+func (dec *Decoder) decodeDiscriminated(value, discriminator reflect.Value, version int) error {
+
+	id, ok := intValue(discriminator)
+	if !ok {
+		return &CodecError{Name: "interface", Msg: "discriminator field of type " + discriminator.Type().String() + " is not an integer"}
+	}
+
+	switch {
+	case value.Kind() == reflect.Interface:
+		return dec.decodeRegistered(value, id, version)
+
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Interface:
+		size, err := dec.decodeLen()
 		if err != nil {
 			return err
 		}
 
+		value.Set(reflect.MakeSlice(value.Type(), 0, 0))
+		for i := 0; i < size; i++ {
+			start := dec.r.offset
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := dec.decodeRegistered(elem, id, version); err != nil {
+				return wrapError(err, "decode", fmt.Sprintf("[%d]", i), start, "")
+			}
+			value.Set(reflect.Append(value, elem))
+		}
+		return nil
+	}
+
+	return &CodecError{Name: "interface", Msg: "discriminator set on " + value.Type().String() + " field"}
+}
+
+// decodeRegistered decodes a value of the type registered under id and stores it in the interface value.
+func (dec *Decoder) decodeRegistered(value reflect.Value, id int, version int) error {
+
+	concrete, err := newRegistered(id, value.Type())
+	if err != nil {
+		return err
 	}
 
+	if err := dec.decodeValue(concrete, version); err != nil {
+		return err
+	}
+
+	value.Set(concrete)
 	return nil
 }
 
-func (dec *Decoder) decodePtr(value reflect.Value, version int) error {
+// decodeNull reads the null marker of a nullable field and reports whether the field is null.
+func (dec *Decoder) decodeNull(field CodecField) (bool, error) {
+
+	null, n, err := ReadNull(dec.r, field.nullInline)
+	dec.n += n
+	return null, err
+}
+
+// ReadNull reads the null marker of a nullable field and reports whether
+// the field is null. If inline is set, the value carries the marker itself,
+// so only NULL_BYTE is consumed; this needs r to be the reader handed
+// to an Unmarshaler or an io.ByteScanner.
+func ReadNull(r io.Reader, inline bool) (bool, int, error) {
 
-	un, _, rValue := indirect(value, false)
+	if inline {
+		b, err := peekByte(r)
+		if err != nil {
+			return false, 0, readError("null", err)
+		}
+		if b != NULL_BYTE {
+			return false, 0, nil
+		}
+	}
 
-	if un != nil {
+	buf, n, err := readN(r, 1)
+	if err != nil {
+		return false, n, readError("null", err)
+	}
+
+	switch buf[0] {
+	case NULL_BYTE:
+		return true, n, nil
+	case 0:
+		return false, n, nil
+	}
+
+	return false, n, &CodecError{Name: "null", Msg: fmt.Sprintf("unexpected null marker 0x%02x", buf[0]), Err: ErrNullExpected}
+}
+
+// peekByte returns the next byte of r without consuming it.
+func peekByte(r io.Reader) (byte, error) {
+
+	switch r := r.(type) {
+	case *reader:
+		return r.peekByte()
+	case io.ByteScanner:
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		return b, r.UnreadByte()
+	}
+
+	return 0, errors.New("ras: reader cannot peek the null marker")
+}
+
+// decodeUnmarshaler hands the input over to an Unmarshaler or a Parser.
+// A Parser gets the buffered bytes and reports how many of them it consumed.
+func (dec *Decoder) decodeUnmarshaler(un Unmarshaler, parser Parser, version int) error {
 
-		n, err := un.UnmarshalRAS(dec.buf, version)
+	if un != nil {
+		n, err := un.UnmarshalRAS(dec.r, version)
 		dec.n += n
 		if err != nil {
 			return err
 		}
 		return nil
+	}
 
+	data, err := dec.r.buffered()
+	if err != nil {
+		return err
+	}
+
+	n, err := parser.ParseRAS(data, version)
+	if n > len(data) {
+		n = len(data)
+	}
+	dec.r.discard(n)
+	dec.n += n
+	if err != nil {
+		return err
 	}
 
-	//
-	// valType := value.Type()
-	// valElemType := valType.Elem()
-	//
-	// if value.CanSet() {
-	// 	realVal := reflect.New(valElemType)
-	//
-	// 	if err := dec.decodeValue(reflect.Indirect(realVal), version); err != nil {
-	// 		return err
-	// 	}
-	//
-	// 	value.Set(realVal)
-	// } else {
-	// 	if err := dec.decodeValue(reflect.Indirect(value), version); err != nil {
-	// 		return err
-	// 	}
-	// }
-	return dec.decodeValue(rValue, version)
+	return nil
 }
 
 func (dec *Decoder) decodeSlice(value reflect.Value, version int) error {
 
-	var size int
-	n, err := decodeSize(dec.buf, &size)
-	dec.n += n
+	size, err := dec.decodeLen()
 	if err != nil {
 		return err
 	}
+
+	if value.IsNil() {
+		// An empty list is not the same as an absent one. The capacity
+		// is bounded, since size comes from the input.
+		capacity := size
+		if capacity > maxPrealloc {
+			capacity = maxPrealloc
+		}
+		value.Set(reflect.MakeSlice(value.Type(), 0, capacity))
+	} else {
+		// The elements are replaced, reusing the memory of the slice.
+		value.SetLen(0)
+	}
+
+	zero := reflect.Zero(value.Type().Elem())
+
 	for i := 0; i < size; i++ {
-		elem := reflectAlloc(value.Type().Elem())
+		start := dec.r.offset
 
-		err := dec.decodeValue(elem, version)
-		if err != nil {
-			return err
+		if i < value.Cap() {
+			value.SetLen(i + 1)
+			value.Index(i).Set(zero)
+		} else {
+			value.Set(reflect.Append(value, zero))
 		}
 
-		value.Set(reflect.Append(value, elem))
+		err := dec.decodeValue(value.Index(i), version)
+		if err != nil {
+			return wrapError(err, "decode", fmt.Sprintf("[%d]", i), start, "")
+		}
 	}
 
 	return nil
 }
 
+// decodeLen reads the number of elements of a list.
+func (dec *Decoder) decodeLen() (int, error) {
+
+	size, n, err := dec.readSize()
+	dec.n += n
+	if err != nil {
+		return 0, err
+	}
+
+	return size, checkLen(dec.r, size)
+}
+
+// readSize reads a size with the CodecReader of the decoder, if set.
+func (dec *Decoder) readSize() (int, int, error) {
+
+	if dec.codec != nil {
+		return dec.codec.ReadSize(dec.r)
+	}
+
+	return readSize(dec.r)
+}
+
+// fieldDecoder returns the decoder of the codec name: the one backed by
+// the CodecReader of the decoder for a built-in name, or else fn.
+func (dec *Decoder) fieldDecoder(name string, fn TypeDecoderFunc) TypeDecoderFunc {
+
+	if dec.decoders != nil && dec.registry.isBuiltinDecoder(name) {
+		if codecFn, ok := dec.decoders[name]; ok {
+			return codecFn
+		}
+	}
+
+	return fn
+}
+
+// DecodeLen reads the number of elements of a list. When r is the reader
+// handed to an Unmarshaler, the length is checked against the limits
+// of the Decoder.
+func DecodeLen(r io.Reader) (int, int, error) {
+
+	size, n, err := readSize(r)
+	if err != nil {
+		return 0, n, err
+	}
+
+	if err := checkLen(r, size); err != nil {
+		return 0, n, err
+	}
+
+	return size, n, nil
+}
+
+// checkLen checks the list size read from r against the limits.
+func checkLen(r io.Reader, size int) error {
+
+	if size < 0 {
+		return &CodecError{Name: "size", Msg: fmt.Sprintf("invalid list size %d", size)}
+	}
+
+	var max int
+	if rr, ok := r.(*reader); ok {
+		max = rr.limits.MaxCollectionLen
+	}
+
+	return checkLimit("collection length", size, max)
+}
+
+// DecodeBytes reads a byte slice written as its size followed by the bytes.
+// When r is the reader handed to an Unmarshaler, the size is checked
+// against the MaxStringLen limit of the Decoder before the bytes are read.
+func DecodeBytes(r io.Reader) ([]byte, int, error) {
+
+	size, n, err := readSize(r)
+	if err != nil {
+		return nil, n, err
+	}
+
+	if err := checkStringLen(r, size); err != nil {
+		return nil, n, err
+	}
+
+	buf := make([]byte, size)
+	m, err := io.ReadFull(r, buf)
+	n += m
+	if err != nil {
+		return nil, n, readError("bytes", err)
+	}
+
+	return buf, n, nil
+}
+
 // indirect walks down v allocating pointers as needed,
 // until it gets to a non-pointer.
 // If it encounters an Unmarshaler, indirect stops and returns that.
@@ -403,10 +845,3 @@ func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, Parser, reflect.
 	}
 	return nil, nil, v
 }
-
-func reflectAlloc(typ reflect.Type) reflect.Value {
-	if typ.Kind() == reflect.Ptr {
-		return reflect.New(typ.Elem())
-	}
-	return reflect.New(typ).Elem()
-}
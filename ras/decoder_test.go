@@ -2,10 +2,13 @@ package ras
 
 import (
 	"bytes"
+	"errors"
 	"github.com/k0kubun/pp"
 	uuid "github.com/satori/go.uuid"
 	pb "google.golang.org/protobuf/types/known/timestamppb"
 	"io"
+	"net"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -74,21 +77,271 @@ func (l *Lock) UnmarshalRAS(reader io.Reader, version int) (n int, err error) {
 
 	c := NewCodecReader()
 
+	var total int
+
 	n, err = c.ReadUuidPtr(&l.UUID, reader)
+	total += n
 	if err != nil {
-		return n, err
+		return total, err
 	}
 
 	n, err = c.ReadIntPtr(&l.ID, reader)
+	total += n
 	if err != nil {
-		return n, err
+		return total, err
 	}
 
 	n, err = c.ReadStringPtr(&l.Msg, reader)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+
+}
+
+func (l *Lock) MarshalRAS(writer io.Writer, version int) (n int, err error) {
+
+	c := NewCodecWriter()
+
+	var total int
+
+	n, err = c.WriteUuid(l.UUID, writer)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteInt(l.ID, writer)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	n, err = c.WriteString(l.Msg, writer)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+
+}
+
+type state byte
+
+func (s *state) ParseRAS(data []byte, version int) (n int, err error) {
+
+	if len(data) == 0 {
+		return 0, errors.New("state: no data")
+	}
+
+	*s = state(data[0])
+	return 1, nil
+}
+
+func TestDecoder_Unmarshaler(t *testing.T) {
+
+	type document struct {
+		Lock   Lock     `rac:",1"`
+		Locks  []Lock   `rac:",2"`
+		Refs   []**Lock `rac:",3"`
+		State  state    `rac:",4"`
+		States []*state `rac:",5"`
+		Count  int      `rac:",6"`
+	}
+
+	lock := Lock{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 7, "msg"}
+
+	codec := NewCodec()
+	buf := bytes.NewBuffer([]byte{})
+	lock.MarshalRAS(buf, 1)
+	codec.WriteSize(1, buf)
+	lock.MarshalRAS(buf, 1)
+	codec.WriteSize(1, buf)
+	lock.MarshalRAS(buf, 1)
+	buf.Write([]byte{5})
+	codec.WriteSize(2, buf)
+	buf.Write([]byte{6, 7})
+	codec.WriteInt(42, buf)
+
+	size := buf.Len()
+
+	var doc document
+	n, err := Decode(buf.Bytes(), &doc, 1)
 	if err != nil {
-		return n, err
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if n != size {
+		t.Errorf("Decode() n = %d, want %d", n, size)
 	}
 
-	return n, nil
+	pLock := &lock
+	s6, s7 := state(6), state(7)
+	want := document{
+		Lock:   lock,
+		Locks:  []Lock{lock},
+		Refs:   []**Lock{&pLock},
+		State:  5,
+		States: []*state{&s6, &s7},
+		Count:  42,
+	}
+
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("Decode() = %+v, want %+v", doc, want)
+	}
+}
 
+func TestDecoder_Stream(t *testing.T) {
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	locks := []Lock{
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 1, "first"},
+		{"6ba7b811-9dad-11d1-80b4-00c04fd430c8", 2, "second"},
+	}
+
+	go func() {
+		defer server.Close()
+		for _, lock := range locks {
+			data, _ := Encode(lock, 1)
+			// Split every value across writes to exercise refills.
+			server.Write(data[:5])
+			server.Write(data[5:])
+		}
+		server.Write([]byte{9})
+	}()
+
+	dec := NewDecoderFromReader(client)
+
+	for _, want := range locks {
+		var lock Lock
+		if _, err := dec.Decode(&lock, 1); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if lock != want {
+			t.Errorf("Decode() = %+v, want %+v", lock, want)
+		}
+	}
+
+	var s state
+	if _, err := dec.Decode(&s, 1); err != nil || s != 9 {
+		t.Fatalf("Decode() = %v, %v, want 9", s, err)
+	}
+
+	if _, err := dec.Decode(&s, 1); err != io.EOF {
+		t.Errorf("Decode() error = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoder_StreamLeftover(t *testing.T) {
+
+	codec := NewCodec()
+	buf := bytes.NewBuffer([]byte{})
+	codec.WriteInt(1, buf)
+	codec.WriteInt(2, buf)
+
+	src := bytes.NewReader(buf.Bytes())
+	dec := NewDecoderFromReader(src)
+
+	var first int
+	if _, err := dec.Decode(&first, 1); err != nil || first != 1 {
+		t.Fatalf("Decode() = %d, %v, want 1", first, err)
+	}
+
+	if src.Len() != 4 {
+		t.Errorf("Decode() read %d bytes ahead of the value", 4-src.Len())
+	}
+
+	var second int
+	if _, err := dec.Decode(&second, 1); err != nil || second != 2 {
+		t.Fatalf("Decode() = %d, %v, want 2", second, err)
+	}
+}
+
+func TestDecoder_Cursor(t *testing.T) {
+
+	codec := NewCodec()
+	buf := bytes.NewBuffer([]byte{})
+	codec.WriteInt(1, buf)
+	codec.WriteInt(2, buf)
+
+	dec := NewDecoder(buf.Bytes())
+
+	var values []int
+	for dec.More() {
+		var v int
+		if _, err := dec.Decode(&v, 1); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		values = append(values, v)
+
+		if want := 4 * len(values); dec.Offset() != want || dec.Remaining() != 8-want {
+			t.Errorf("Offset(), Remaining() = %d, %d, want %d, %d", dec.Offset(), dec.Remaining(), want, 8-want)
+		}
+	}
+
+	if !reflect.DeepEqual(values, []int{1, 2}) {
+		t.Errorf("Decode() = %v, want [1 2]", values)
+	}
+
+	stream := NewDecoderFromReader(bytes.NewReader(buf.Bytes()))
+	stream.DisallowTrailingBytes()
+
+	var v int
+	if _, err := stream.Decode(&v, 1); !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("Decode() error = %v, want ErrTrailingBytes", err)
+	}
+
+	if _, err := DecodeAll(buf.Bytes()[:4], &v, 1); err != nil || v != 1 {
+		t.Errorf("DecodeAll() = %d, %v, want 1", v, err)
+	}
+
+	if _, err := DecodeAll(buf.Bytes(), &v, 1); !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("DecodeAll() error = %v, want ErrTrailingBytes", err)
+	}
+}
+
+func TestCodecReader_ReadSize(t *testing.T) {
+
+	var buf bytes.Buffer
+	if _, err := NewCodecWriter().WriteSize(300, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	size, n, err := NewCodecReader().ReadSize(&buf)
+	if err != nil || size != 300 || n != 2 {
+		t.Errorf("ReadSize() = %d, %d, %v, want 300, 2", size, n, err)
+	}
+}
+
+func TestDecode_UUIDBytesNotShared(t *testing.T) {
+
+	type value struct {
+		ID []byte `ras:"1,codec=uuid"`
+	}
+
+	id := uuid.NewV4()
+	data, err := Encode(value{ID: id.Bytes()}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got value
+	decoder := NewDecoder(data)
+	if _, err := decoder.Decode(&got, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range data {
+		data[i] = 0
+	}
+	decoder.Reset(data)
+
+	if !bytes.Equal(got.ID, id.Bytes()) {
+		t.Errorf("ID = %x after the input changed, want %x", got.ID, id.Bytes())
+	}
 }
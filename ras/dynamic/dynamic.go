@@ -0,0 +1,372 @@
+// Package dynamic decodes and encodes RAS messages described by a protobuf
+// descriptor set, such as the image.json of the serialize schema, so that
+// any message can be read without Go types generated for it.
+//
+//	schema, err := dynamic.LoadFile("image.json")
+//	...
+//	m, err := schema.Unmarshal("SessionInfo", data, version)
+//	...
+//	user, err := m.Get("user_name")
+//
+// The wire layout is read from the v8platform.ras.serialize.tags options
+// of the fields, see ras.MarshalProto.
+package dynamic
+
+import (
+	"errors"
+	"fmt"
+	"github.com/v8platform/encoder/internal/prototag"
+	"github.com/v8platform/encoder/ras"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	pb "google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnknownMessage is wrapped by the errors for message names not in the schema.
+var ErrUnknownMessage = errors.New("dynamic: unknown message")
+
+// ErrUnknownField is wrapped by the errors for field names not in the message.
+var ErrUnknownField = errors.New("dynamic: unknown field")
+
+// Schema holds the messages of a descriptor set.
+type Schema struct {
+	files *protoregistry.Files
+}
+
+// Load reads a FileDescriptorSet in the binary or the JSON encoding.
+// The files must come in dependency order, as buf and protoc write them.
+func Load(data []byte) (*Schema, error) {
+
+	set, err := prototag.UnmarshalSet(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSchema(set)
+}
+
+// LoadFile reads the descriptor set in the named file, see Load.
+func LoadFile(name string) (*Schema, error) {
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(data)
+}
+
+// NewSchema returns the schema of the descriptor set.
+func NewSchema(set *descriptorpb.FileDescriptorSet) (*Schema, error) {
+
+	files, err := prototag.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schema{files: files}, nil
+}
+
+// Files returns the files of the schema.
+func (s *Schema) Files() *protoregistry.Files {
+	return s.files
+}
+
+// Descriptor returns the message of the name. The name is a full name,
+// such as v8platform.ras.serialize.SessionInfo, or the short name
+// of a message that is the only one called so.
+func (s *Schema) Descriptor(name string) (protoreflect.MessageDescriptor, error) {
+
+	if d, err := s.files.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+		if md, ok := d.(protoreflect.MessageDescriptor); ok {
+			return md, nil
+		}
+	}
+
+	var found []protoreflect.MessageDescriptor
+	s.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		found = appendByName(found, fd.Messages(), protoreflect.Name(name))
+		return true
+	})
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%w %s", ErrUnknownMessage, name)
+	case 1:
+		return found[0], nil
+	}
+
+	return nil, fmt.Errorf("dynamic: message name %s is ambiguous: %s and %s", name, found[0].FullName(), found[1].FullName())
+}
+
+func appendByName(found []protoreflect.MessageDescriptor, mds protoreflect.MessageDescriptors, name protoreflect.Name) []protoreflect.MessageDescriptor {
+
+	for i := 0; i < mds.Len(); i++ {
+		md := mds.Get(i)
+		if md.Name() == name && !md.IsMapEntry() {
+			found = append(found, md)
+		}
+		found = appendByName(found, md.Messages(), name)
+	}
+
+	return found
+}
+
+// New returns an empty message of the name, see Descriptor.
+func (s *Schema) New(name string) (*Message, error) {
+
+	md, err := s.Descriptor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMessage(md), nil
+}
+
+// Unmarshal decodes data into a new message of the name. Data must hold
+// exactly one message: bytes left after it are reported as an error
+// wrapping ras.ErrTrailingBytes.
+func (s *Schema) Unmarshal(name string, data []byte, version int) (*Message, error) {
+
+	m, err := s.New(name)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := ras.NewDecoder(data)
+	decoder.DisallowTrailingBytes()
+
+	if _, err := decoder.DecodeProto(m, version); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Message is a dynamic message whose fields are addressed by name.
+// It implements ras.Marshaller and ras.Unmarshaler, so it may be coded
+// on its own or as a value of a struct field.
+type Message struct {
+	*dynamicpb.Message
+}
+
+// NewMessage returns an empty message of the descriptor.
+func NewMessage(md protoreflect.MessageDescriptor) *Message {
+	return &Message{dynamicpb.NewMessage(md)}
+}
+
+// MarshalRAS writes the message in the protocol version. As a value of
+// a struct field, it is written with the options of the Encoder.
+func (m *Message) MarshalRAS(w io.Writer, version int) (int, error) {
+	return ras.EncodeProtoValue(w, m, version)
+}
+
+// UnmarshalRAS reads the message in the protocol version. As a value of
+// a struct field, it is read with the options and limits of the Decoder.
+func (m *Message) UnmarshalRAS(r io.Reader, version int) (int, error) {
+	return ras.DecodeProtoValue(r, m, version)
+}
+
+// Field returns the descriptor of the named field.
+func (m *Message) Field(name string) (protoreflect.FieldDescriptor, error) {
+
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		return nil, fmt.Errorf("%w %s in %s", ErrUnknownField, name, m.Descriptor().FullName())
+	}
+
+	return fd, nil
+}
+
+// Get returns the value of the named field as a Go value: a bool, int32,
+// uint32, int64, uint64, float32, float64, string or []byte, a
+// protoreflect.EnumNumber, a time.Time for a timestamp, a *Message for
+// any other message, or a []interface{} of those for a repeated field.
+// An unset message field is returned as nil.
+func (m *Message) Get(name string) (interface{}, error) {
+
+	fd, err := m.Field(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if fd.IsMap() {
+		return nil, fmt.Errorf("dynamic: %s: map fields are not supported", name)
+	}
+
+	if fd.IsList() {
+		list := m.Message.Get(fd).List()
+		values := make([]interface{}, list.Len())
+		for i := range values {
+			values[i] = goValue(fd, list.Get(i))
+		}
+		return values, nil
+	}
+
+	if fd.Message() != nil && !m.Has(fd) {
+		return nil, nil
+	}
+
+	return goValue(fd, m.Message.Get(fd)), nil
+}
+
+// Set sets the named field to a Go value of the kinds returned by Get.
+// A slice of them sets a repeated field, nil clears the field.
+func (m *Message) Set(name string, v interface{}) error {
+
+	fd, err := m.Field(name)
+	if err != nil {
+		return err
+	}
+
+	if fd.IsMap() {
+		return fmt.Errorf("dynamic: %s: map fields are not supported", name)
+	}
+
+	if v == nil {
+		m.Clear(fd)
+		return nil
+	}
+
+	if !fd.IsList() {
+		value, err := protoValue(fd, v)
+		if err != nil {
+			return fmt.Errorf("dynamic: %s: %w", name, err)
+		}
+		m.Message.Set(fd, value)
+		return nil
+	}
+
+	values, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("dynamic: %s: set repeated field to %T, want []interface{}", name, v)
+	}
+
+	list := m.NewField(fd).List()
+	for _, elem := range values {
+		value, err := protoValue(fd, elem)
+		if err != nil {
+			return fmt.Errorf("dynamic: %s: %w", name, err)
+		}
+		list.Append(value)
+	}
+	m.Message.Set(fd, protoreflect.ValueOfList(list))
+
+	return nil
+}
+
+func goValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return v.Enum()
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		msg := v.Message()
+		if msg.Descriptor().FullName() == "google.protobuf.Timestamp" {
+			fds := msg.Descriptor().Fields()
+			return time.Unix(msg.Get(fds.ByNumber(1)).Int(), msg.Get(fds.ByNumber(2)).Int())
+		}
+		if dm, ok := msg.Interface().(*dynamicpb.Message); ok {
+			return &Message{dm}
+		}
+		return msg.Interface()
+	}
+
+	return v.Interface()
+}
+
+func protoValue(fd protoreflect.FieldDescriptor, v interface{}) (protoreflect.Value, error) {
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		switch v := v.(type) {
+		case protoreflect.EnumNumber:
+			return protoreflect.ValueOfEnum(v), nil
+		case int32:
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		md := fd.Message()
+		switch v := v.(type) {
+		case time.Time:
+			if md.FullName() == "google.protobuf.Timestamp" {
+				ts := pb.New(v)
+				msg := dynamicpb.NewMessage(md)
+				msg.Set(md.Fields().ByNumber(1), protoreflect.ValueOfInt64(ts.Seconds))
+				msg.Set(md.Fields().ByNumber(2), protoreflect.ValueOfInt32(ts.Nanos))
+				return protoreflect.ValueOfMessage(msg), nil
+			}
+		case *Message:
+			if v.Descriptor() == md {
+				return protoreflect.ValueOfMessage(v.Message), nil
+			}
+		case *dynamicpb.Message:
+			if v.Descriptor() == md {
+				return protoreflect.ValueOfMessage(v), nil
+			}
+		}
+	default:
+		value := protoreflect.ValueOf(scalar(v))
+		if value.IsValid() && scalarFits(fd.Kind(), value) {
+			return value, nil
+		}
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("cannot use %T as %s", v, kindName(fd))
+}
+
+// scalar returns v if protoreflect.ValueOf takes it, or nil.
+func scalar(v interface{}) interface{} {
+
+	switch v.(type) {
+	case bool, int32, int64, uint32, uint64, float32, float64, string, []byte:
+		return v
+	}
+
+	return nil
+}
+
+// scalarFits reports whether the value holds the Go type of the kind.
+func scalarFits(kind protoreflect.Kind, v protoreflect.Value) bool {
+
+	var ok bool
+	switch kind {
+	case protoreflect.BoolKind:
+		_, ok = v.Interface().(bool)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		_, ok = v.Interface().(int32)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		_, ok = v.Interface().(uint32)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		_, ok = v.Interface().(int64)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		_, ok = v.Interface().(uint64)
+	case protoreflect.FloatKind:
+		_, ok = v.Interface().(float32)
+	case protoreflect.DoubleKind:
+		_, ok = v.Interface().(float64)
+	case protoreflect.StringKind:
+		_, ok = v.Interface().(string)
+	case protoreflect.BytesKind:
+		_, ok = v.Interface().([]byte)
+	}
+
+	return ok
+}
+
+func kindName(fd protoreflect.FieldDescriptor) string {
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return string(fd.Enum().FullName())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().FullName())
+	}
+
+	return fd.Kind().String()
+}
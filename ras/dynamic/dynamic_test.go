@@ -0,0 +1,184 @@
+package dynamic
+
+import (
+	"errors"
+	"github.com/v8platform/encoder/ras"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadSchema(t *testing.T) *Schema {
+
+	schema, err := LoadFile("../../image.json")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	return schema
+}
+
+func TestSchema_RoundTrip(t *testing.T) {
+
+	schema := loadSchema(t)
+
+	session, err := schema.New("SessionInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	license, err := schema.New("v8platform.ras.serialize.LicenseInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Date(2021, 3, 4, 5, 6, 7, 8e6, time.UTC)
+	for _, set := range []struct {
+		m     *Message
+		field string
+		value interface{}
+	}{
+		{license, "userName", "admin"},
+		{license, "issuedByServer", true},
+		{session, "uuid", "0e7e9a47-3e2d-4f2d-9c0a-6e2e5a2c1b7f"},
+		{session, "id", int32(7)},
+		{session, "user_name", "admin"},
+		{session, "started_at", started},
+		{session, "last_active_at", time.Unix(0, 0)},
+		{session, "db_proc_took_at", time.Unix(0, 0)},
+		{session, "licenses", []interface{}{license}},
+	} {
+		if err := set.m.Set(set.field, set.value); err != nil {
+			t.Fatalf("Set(%s) error = %v", set.field, err)
+		}
+	}
+
+	for _, version := range []int{1, 10} {
+		data, err := ras.Encode(session, version)
+		if err != nil {
+			t.Fatalf("Encode(%d) error = %v", version, err)
+		}
+
+		got, err := schema.Unmarshal("SessionInfo", data, version)
+		if err != nil {
+			t.Fatalf("Unmarshal(%d) error = %v", version, err)
+		}
+
+		// The uuid is added in version 5.
+		want := proto.Clone(session.Message)
+		if version < 5 {
+			want.ProtoReflect().Clear(session.Descriptor().Fields().ByName("uuid"))
+		}
+
+		if !proto.Equal(got.Message, want) {
+			t.Errorf("Unmarshal(%d) = %v, want %v", version, got, want)
+		}
+	}
+
+	data, err := ras.Encode(session, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := schema.Unmarshal("SessionInfo", data, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := got.Get("started_at"); err != nil || !v.(time.Time).Equal(started) {
+		t.Errorf("Get(started_at) = %v, %v, want %v", v, err, started)
+	}
+
+	licenses, err := got.Get("licenses")
+	if err != nil || len(licenses.([]interface{})) != 1 {
+		t.Fatalf("Get(licenses) = %v, %v, want one license", licenses, err)
+	}
+
+	if v, err := licenses.([]interface{})[0].(*Message).Get("userName"); err != nil || v != "admin" {
+		t.Errorf("Get(userName) = %v, %v, want admin", v, err)
+	}
+
+	if _, err := schema.Unmarshal("SessionInfo", append(data, 0), 10); !errors.Is(err, ras.ErrTrailingBytes) {
+		t.Errorf("Unmarshal() error = %v, want ErrTrailingBytes", err)
+	}
+}
+
+func TestSchema_Errors(t *testing.T) {
+
+	schema := loadSchema(t)
+
+	if _, err := schema.New("NoSuchMessage"); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("New() error = %v, want ErrUnknownMessage", err)
+	}
+
+	m, err := schema.New("ClusterInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Set("no_such_field", "x"); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("Set() error = %v, want ErrUnknownField", err)
+	}
+
+	if err := m.Set("expiration_timeout", "x"); err == nil {
+		t.Error("Set(int32 field, string) error = nil")
+	}
+}
+
+// licensed holds a dynamic message as a value of a struct field.
+type licensed struct {
+	License *Message `ras:"1"`
+}
+
+func TestMessage_CoderOptions(t *testing.T) {
+
+	schema := loadSchema(t)
+
+	license, err := schema.New("LicenseInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := license.Set("userName", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	encodeString, _ := ras.DefaultRegistry().EncoderFunc("string")
+	upper := ras.DefaultRegistry().Clone()
+	upper.RegisterEncoderType("string", func(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
+		return encodeString(w, strings.ToUpper(value.(string)), opts...)
+	})
+
+	data, err := ras.Encode(licensed{license}, 10, ras.WithRegistry(upper))
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	if size, err := ras.Size(licensed{license}, 10, ras.WithRegistry(upper)); err != nil || size != len(data) {
+		t.Errorf("Size() = %d, %v, want %d", size, err, len(data))
+	}
+
+	// A nil *Message has no descriptor to decode by.
+	empty, err := schema.New("LicenseInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := licensed{License: empty}
+	if _, err := ras.DecodeAll(data, &got, 10); err != nil {
+		t.Fatalf("DecodeAll() error = %v", err)
+	}
+
+	if v, err := got.License.Get("userName"); err != nil || v != "ADMIN" {
+		t.Errorf("Get(userName) = %v, %v, want ADMIN, written with the registry of the Encoder", v, err)
+	}
+
+	decoder := ras.NewDecoder(data)
+	decoder.SetLimits(ras.Limits{MaxStringLen: 3})
+
+	var limitErr *ras.LimitError
+	if _, err := decoder.Decode(&got, 10); !errors.As(err, &limitErr) {
+		t.Errorf("Decode() error = %v, want *LimitError of the Decoder", err)
+	}
+}
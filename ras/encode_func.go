@@ -8,41 +8,36 @@ import (
 	"io"
 	"math"
 	"reflect"
-	"strings"
 	"time"
 )
 
-var encoderFunc = map[string]TypeEncoderFunc{}
-
-type TypeEncoderFunc func(r io.Writer, value interface{}) (int, error)
-
-func init() {
-	RegisterEncoderType("time", encodeTime)
-	RegisterEncoderType("type", encodeType)
-	RegisterEncoderType("bool", encodeBool)
-	RegisterEncoderType("byte int8 uint8", encodeByte)
-	RegisterEncoderType("char short int16 uint16", encodeUint16)
-	RegisterEncoderType("int int32 uint32", encodeUint32)
-	RegisterEncoderType("int64 uint64 long", encodeUint64)
-	RegisterEncoderType("float32", encodeFloat32)
-	RegisterEncoderType("float64 double", encodeFloat64)
-	RegisterEncoderType("string", encodeString)
-	RegisterEncoderType("null-size", encodeNullableSize)
-	RegisterEncoderType("size", encodeSize)
-	RegisterEncoderType("uuid", EncodeUuid)
-}
+type TypeEncoderFunc func(r io.Writer, value interface{}, opts ...map[string]string) (int, error)
+
+// EncodeValue encodes value with the encoder registered under the name.
+// When r is the writer handed to a Marshaller, the encoder is looked up
+// in the registry of the Encoder and backed by its CodecWriter, see
+// WithRegistry and WithCodecWriter; otherwise the default registry is used.
+func EncodeValue(encoder string, r io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 
-func EncodeValue(encoder string, r io.Writer, value interface{}) (int, error) {
+	registry := defaultRegistry
+	w, fromEncoder := r.(*encoderWriter)
+	if fromEncoder {
+		registry = w.enc.registry
+	}
 
-	typeEncoderFunc, ok := encoderFunc[encoder]
+	typeEncoderFunc, ok := registry.EncoderFunc(encoder)
 	if !ok {
-		return 0, fmt.Errorf("unknown encoder <%s>", encoder)
+		return 0, &CodecError{Name: encoder, Msg: "unknown encoder"}
 	}
 
-	return typeEncoderFunc(r, value)
+	if fromEncoder {
+		typeEncoderFunc = w.enc.fieldEncoder(encoder, typeEncoderFunc)
+	}
+
+	return typeEncoderFunc(r, value, opts...)
 }
 
-func EncodeUuid(r io.Writer, value interface{}) (int, error) {
+func EncodeUuid(r io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 
 	switch val := value.(type) {
 	case []byte:
@@ -50,7 +45,7 @@ func EncodeUuid(r io.Writer, value interface{}) (int, error) {
 	case *[]byte:
 		return writeBuf("uuid", r, *val)
 	case *uuid.UUID:
-		return writeBuf("uuid", r, val.Bytes())
+		return writeBuf("uuid", r, val[:])
 	case uuid.UUID:
 		return writeBuf("uuid", r, val.Bytes())
 	case string:
@@ -58,21 +53,17 @@ func EncodeUuid(r io.Writer, value interface{}) (int, error) {
 	case *string:
 		return writeBuf("uuid", r, uuid.FromStringOrNil(*val).Bytes())
 	default:
-		return 0, &TypeEncoderError{"uuid", "unknown uuid type"}
+		return 0, &CodecError{Name: "uuid", Msg: "unknown uuid type"}
 	}
 
 }
 
+// RegisterEncoderType registers the encoder in the default registry, see Registry.
 func RegisterEncoderType(name string, dec TypeEncoderFunc) {
-
-	names := strings.Fields(strings.ToLower(name))
-
-	for _, s := range names {
-		encoderFunc[s] = dec
-	}
+	defaultRegistry.RegisterEncoderType(name, dec)
 }
 
-func encodeTime(w io.Writer, value interface{}) (int, error) {
+func encodeTime(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val int64
 
 	switch tVal := value.(type) {
@@ -93,16 +84,16 @@ func encodeTime(w io.Writer, value interface{}) (int, error) {
 	case *pb.Timestamp:
 		val = tVal.AsTime().UnixNano()
 	default:
-		return 0, &TypeEncoderError{"time", "TODO"}
+		return 0, &CodecError{Name: "time", Msg: "TODO"}
 	}
 	ticks := val / int64(time.Millisecond)
 	ticks = ticks*10 + AgeDelta
 
-	return encodeUint64(w, ticks)
+	return writeUint64(w, uint64(ticks))
 
 }
 
-func encodeUint16(w io.Writer, value interface{}) (int, error) {
+func encodeUint16(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val uint16
 
 	switch tVal := value.(type) {
@@ -115,15 +106,13 @@ func encodeUint16(w io.Writer, value interface{}) (int, error) {
 	case *uint16:
 		val = uint16(*tVal)
 	default:
-		return 0, &TypeEncoderError{"uint16", "TODO"}
+		return 0, &CodecError{Name: "uint16", Msg: "TODO"}
 	}
-	buf := make([]byte, 2)
-	binary.BigEndian.PutUint16(buf, val)
-	return writeBuf("uint16", w, buf)
+	return writeUint16(w, val)
 
 }
 
-func encodeUint32(w io.Writer, value interface{}) (int, error) {
+func encodeUint32(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val uint32
 
 	switch tVal := value.(type) {
@@ -144,15 +133,13 @@ func encodeUint32(w io.Writer, value interface{}) (int, error) {
 	case *uint32:
 		val = uint32(*tVal)
 	default:
-		return 0, &TypeEncoderError{"uint32", "TODO"}
+		return 0, &CodecError{Name: "uint32", Msg: "TODO"}
 	}
-	buf := make([]byte, 4)
-	binary.BigEndian.PutUint32(buf, val)
-	return writeBuf("uint32", w, buf)
+	return writeUint32(w, val)
 
 }
 
-func encodeUint64(w io.Writer, value interface{}) (int, error) {
+func encodeUint64(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val uint64
 
 	switch tVal := value.(type) {
@@ -165,15 +152,13 @@ func encodeUint64(w io.Writer, value interface{}) (int, error) {
 	case *uint64:
 		val = uint64(*tVal)
 	default:
-		return 0, &TypeEncoderError{"uint64", fmt.Sprintf("%s", reflect.TypeOf(tVal))}
+		return 0, &CodecError{Name: "uint64", Msg: fmt.Sprintf("%s", reflect.TypeOf(tVal))}
 	}
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, val)
-	return writeBuf("uint64", w, buf)
+	return writeUint64(w, val)
 
 }
 
-func encodeFloat32(w io.Writer, value interface{}) (int, error) {
+func encodeFloat32(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val float32
 
 	switch tVal := value.(type) {
@@ -182,12 +167,12 @@ func encodeFloat32(w io.Writer, value interface{}) (int, error) {
 	case *float32:
 		val = *tVal
 	default:
-		return 0, &TypeEncoderError{"float32", "TODO"}
+		return 0, &CodecError{Name: "float32", Msg: "TODO"}
 	}
-	return encodeUint32(w, math.Float32bits(val))
+	return writeUint32(w, math.Float32bits(val))
 }
 
-func encodeFloat64(w io.Writer, value interface{}) (int, error) {
+func encodeFloat64(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val float64
 
 	switch tVal := value.(type) {
@@ -196,52 +181,68 @@ func encodeFloat64(w io.Writer, value interface{}) (int, error) {
 	case *float64:
 		val = *tVal
 	default:
-		return 0, &TypeEncoderError{"float64", "TODO"}
+		return 0, &CodecError{Name: "float64", Msg: "TODO"}
 	}
-	return encodeUint64(w, math.Float64bits(val))
+	return writeUint64(w, math.Float64bits(val))
 
 }
 
-func encodeString(w io.Writer, value interface{}) (int, error) {
-	var val []byte
+func encodeString(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 
 	switch tVal := value.(type) {
 	case []byte:
-		val = tVal
+		return writeSizedBytes(w, tVal)
 	case *[]byte:
-		val = *tVal
+		return writeSizedBytes(w, *tVal)
 	case string:
-		val = []byte(tVal)
+		return writeString(w, tVal)
 	case *string:
-		val = []byte(*tVal)
+		return writeString(w, *tVal)
 	default:
-		return 0, &TypeEncoderError{"string", "TODO"}
+		return 0, &CodecError{Name: "string", Msg: "TODO"}
 	}
 
-	if len(val) == 0 {
-		n, err := writeNull(w)
-		if err != nil {
-			return 0, err
-		}
-		return n, nil
+}
+
+// writeSizedBytes writes b with its nullable size.
+func writeSizedBytes(w io.Writer, b []byte) (int, error) {
+
+	n, err := encodeNullableSize(w, len(b))
+	if err != nil || len(b) == 0 {
+		return n, err
 	}
 
-	size := len(val)
+	bufN, err := writeBuf("string", w, b)
+	return bufN + n, err
+}
+
+// writeString writes s with its nullable size.
+func writeString(w io.Writer, s string) (int, error) {
+
+	size := len(s)
 	n, err := encodeNullableSize(w, size)
 	if err != nil {
 		return 0, err
 	}
 
-	bufN, err := writeBuf("string", w, val)
+	if size == 0 {
+		return n, nil
+	}
+
+	if aw, ok := w.(*appendWriter); ok {
+		aw.buf = append(aw.buf, s...)
+		return n + size, nil
+	}
+
+	bufN, err := io.WriteString(w, s)
 	if err != nil {
-		return bufN + n, err
+		return bufN + n, writeError("string", err)
 	}
 
 	return bufN + n, nil
-
 }
 
-func encodeType(w io.Writer, value interface{}) (int, error) {
+func encodeType(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val byte
 
 	switch tVal := value.(type) {
@@ -254,17 +255,17 @@ func encodeType(w io.Writer, value interface{}) (int, error) {
 	case *uint8:
 		val = byte(*tVal)
 	default:
-		return 0, &TypeEncoderError{"type", "TODO"}
+		return 0, &CodecError{Name: "type", Msg: "TODO"}
 	}
 
 	if val == NULL_BYTE {
 		return writeNull(w)
 	}
-	return writeBuf("type", w, []byte{val})
+	return writeByte("type", w, val)
 
 }
 
-func encodeBool(w io.Writer, value interface{}) (int, error) {
+func encodeBool(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val byte
 
 	switch tVal := value.(type) {
@@ -283,14 +284,14 @@ func encodeBool(w io.Writer, value interface{}) (int, error) {
 			val = TRUE_BYTE
 		}
 	default:
-		return 0, &TypeEncoderError{"bool", "TODO"}
+		return 0, &CodecError{Name: "bool", Msg: "TODO"}
 	}
 
-	return writeBuf("bool", w, []byte{val})
+	return writeByte("bool", w, val)
 
 }
 
-func encodeByte(w io.Writer, value interface{}) (int, error) {
+func encodeByte(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 	var val byte
 
 	switch tVal := value.(type) {
@@ -303,109 +304,137 @@ func encodeByte(w io.Writer, value interface{}) (int, error) {
 	case *uint8:
 		val = byte(*tVal)
 	default:
-		return 0, &TypeEncoderError{"byte", "TODO"}
+		return 0, &CodecError{Name: "byte", Msg: "TODO"}
 	}
 
 	if val == NULL_BYTE {
 		return writeNull(w)
 	}
-	return writeBuf("byte", w, []byte{val})
+	return writeByte("byte", w, val)
 
 }
 
-func encodeSize(w io.Writer, value interface{}) (int, error) {
+func encodeSize(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 
 	val, err := castToInt("size", value)
 	if err != nil {
 		return 0, err
 	}
 
-	var b1 int
-
-	msb := val >> MAX_SHIFT
-	if msb != 0 {
-		b1 = -128
-	} else {
-		b1 = 0
+	if val < 0 {
+		return 0, &CodecError{Name: "size", Msg: fmt.Sprintf("negative size %d", val)}
 	}
 
-	var total int
-	n, err := writeBuf("size", w, []byte{byte(b1 | (val & 0x7F))})
-	if err != nil {
-		return n, err
-	}
-	total += n
-	for val = msb; val > 0; val = msb {
+	// The size is collected first and written at once.
+	buf := scratch(w, 10)
+	i := 0
 
-		msb >>= MAX_SHIFT
-		if msb != 0 {
-			b1 = -128
-		} else {
-			b1 = 0
+	for {
+		msb := val >> MAX_SHIFT
+		if msb == 0 {
+			buf[i] = byte(val & 0x7F)
+			i++
+			break
 		}
 
-		n, err := writeBuf("size", w, []byte{byte(b1 | (val & 0x7F))})
-		if err != nil {
-			return n, err
-		}
-		total += n
+		buf[i] = byte(NEXT_MASK | (val & 0x7F))
+		i++
+		val = msb
 	}
 
-	return total, err
+	return writeBuf("size", w, buf[:i])
 }
 
-func encodeNullableSize(w io.Writer, value interface{}) (int, error) {
+func encodeNullableSize(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
 
 	val, err := castToInt("null-size", value)
 	if err != nil {
 		return 0, err
 	}
 
-	var b1 int
+	if val < 0 {
+		return 0, &CodecError{Name: "null-size", Msg: fmt.Sprintf("negative size %d", val)}
+	}
+
+	// The size is collected first and written at once.
+	buf := scratch(w, 10)
+	i := 0
 
 	msb := val >> NULL_SHIFT
 	if msb != 0 {
-		b1 = NULL_NEXT_MASK
+		buf[i] = byte(NULL_NEXT_MASK | (val & 0x7F))
 	} else {
-		b1 = 0
+		buf[i] = byte(val & 0x7F)
 	}
-
-	var total int
-
-	n, err := writeBuf("null-size", w, []byte{byte(b1 | (val & 0x7F))})
-	if err != nil {
-		return n, err
-	}
-	total += n
+	i++
 
 	for val = msb; val > 0; val = msb {
 
 		msb >>= MAX_SHIFT
 		if msb != 0 {
-			b1 = NEXT_MASK
+			buf[i] = byte(NEXT_MASK | (val & 0x7F))
 		} else {
-			b1 = 0
-		}
-
-		n, err := writeBuf("null-size", w, []byte{byte(b1 | (val & 0x7F))})
-		if err != nil {
-			return n, err
+			buf[i] = byte(val & 0x7F)
 		}
-		total += n
+		i++
 	}
 
-	return total, nil
+	return writeBuf("null-size", w, buf[:i])
 }
 
+// writeNull writes the null marker NULL_BYTE.
 func writeNull(w io.Writer) (int, error) {
-	return writeBuf("write null", w, []byte{0x00})
+	return writeByte("write null", w, NULL_BYTE)
+}
+
+// scratch returns n bytes to put an encoded value in before it is written to w.
+// The writer of AppendEncode lends its own, so encoding it allocates nothing.
+func scratch(w io.Writer, n int) []byte {
+
+	if ew, ok := w.(*encoderWriter); ok {
+		w = ew.enc.writer
+	}
+
+	if aw, ok := w.(*appendWriter); ok {
+		return aw.scratch[:n]
+	}
+
+	return make([]byte, n)
+}
+
+func writeByte(fnName string, w io.Writer, val byte) (int, error) {
+
+	buf := scratch(w, 1)
+	buf[0] = val
+	return writeBuf(fnName, w, buf)
+}
+
+func writeUint16(w io.Writer, val uint16) (int, error) {
+
+	buf := scratch(w, 2)
+	binary.BigEndian.PutUint16(buf, val)
+	return writeBuf("uint16", w, buf)
+}
+
+func writeUint32(w io.Writer, val uint32) (int, error) {
+
+	buf := scratch(w, 4)
+	binary.BigEndian.PutUint32(buf, val)
+	return writeBuf("uint32", w, buf)
+}
+
+func writeUint64(w io.Writer, val uint64) (int, error) {
+
+	buf := scratch(w, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return writeBuf("uint64", w, buf)
 }
 
 func writeBuf(fnName string, w io.Writer, buf []byte) (int, error) {
 
 	n, err := w.Write(buf)
 	if err != nil {
-		return n, &EncoderWriteError{fnName, n, err}
+		return n, writeError(fnName, err)
 	}
 
 	return n, nil
@@ -440,35 +469,14 @@ func castToInt(fnName string, value interface{}) (int, error) {
 	case *uint64:
 		val = int(*tVal)
 	default:
-		return 0, &TypeEncoderError{fnName, "TODO"}
+		return 0, &CodecError{Name: fnName, Msg: "TODO"}
 	}
 
 	return val, nil
 }
 
-type EncoderWriteError struct {
-	Mame   string
-	writeN int
-	err    error
-}
-
-func (e *EncoderWriteError) Error() string {
-
-	return "ras: (encoderFunc " + e.Mame + ") write" + e.err.Error() + ""
-}
-
-type TypeEncoderError struct {
-	Mame string
-	Msg  string
-}
+// EncoderWriteError is the former name of CodecError for failed writes.
+type EncoderWriteError = CodecError
 
-func (e *TypeEncoderError) Error() string {
-	// if e.Type == nil {
-	// 	return "ras: Decode(nil)"
-	// }
-
-	// if e.Type.Kind() != reflect.Ptr {
-	// 	return "ras: Decode(non-pointer " + e.Type.String() + ")"
-	// }
-	return "ras: (encoderFunc " + e.Mame + ") " + e.Msg + ""
-}
+// TypeEncoderError is the former name of CodecError for encoder codecs.
+type TypeEncoderError = CodecError
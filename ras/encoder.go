@@ -1,10 +1,12 @@
 package ras
 
 import (
-	"bytes"
+	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"sync"
 	"time"
 )
 
@@ -21,19 +23,111 @@ type Marshaller interface {
 	MarshalRAS(writer io.Writer, version int) (int, error)
 }
 
+// Sizer is implemented by a Marshaller or a Formatter that can tell
+// the size of its encoding without producing it. Size uses it.
+type Sizer interface {
+	SizeRAS(version int) (int, error)
+}
+
 type Encoder struct {
 	writer io.Writer
+	buf    *bufio.Writer // set by NewBufferedEncoder
 	err    error
+	n      int // bytes encoded
+
+	sizing bool // only the size of the encoding is wanted, see Size
+
+	version  int                        // see Marshal
+	registry *Registry                  // set by WithRegistry
+	codec    CodecWriter                // set by WithCodecWriter
+	encoders map[string]TypeEncoderFunc // the built-in encoders backed by codec
+
+	out encoderWriter // the writer Marshallers get, see EncodeValue
+}
+
+// encoderWriter writes to the writer of the Encoder. EncodeValue called
+// with it encodes with the registry and the codecs of the Encoder.
+type encoderWriter struct {
+	enc *Encoder
+}
+
+func (w *encoderWriter) Write(p []byte) (int, error) {
+	return w.enc.writer.Write(p)
 }
 
 // NewDecoder create new encoderFunc for version
 //
-func NewEncoder(r io.Writer) *Encoder {
+func NewEncoder(r io.Writer, opts ...Option) *Encoder {
 
-	return &Encoder{
+	dec := &Encoder{
 		writer: r,
 	}
+	dec.setOptions(opts)
+
+	return dec
+}
+
+// NewBufferedEncoder returns an encoder that collects the encoded bytes
+// in a buffer and writes them to w in large chunks. Call Flush to write
+// out what is left after the last Encode.
+func NewBufferedEncoder(w io.Writer, opts ...Option) *Encoder {
+
+	buf := bufio.NewWriter(w)
+
+	dec := &Encoder{
+		writer: buf,
+		buf:    buf,
+	}
+	dec.setOptions(opts)
+
+	return dec
+}
+
+// setOptions applies the options. A CodecWriter replaces the built-in
+// codecs of the basic types, sizes, null markers and the codecs of the
+// fields tagged with a built-in codec name. Codecs registered with
+// RegisterEncoderType, Marshallers and Formatters are used as they are.
+func (dec *Encoder) setOptions(opts []Option) {
+
+	var o CodecOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dec.version = o.Version
+	dec.registry = o.Registry
+	if dec.registry == nil {
+		dec.registry = defaultRegistry
+	}
+	dec.codec = o.Writer
+	dec.out.enc = dec
+	dec.encoders = nil
+	if o.Writer != nil {
+		dec.encoders = writerEncoders(o.Writer)
+	}
+}
+
+// Version returns the protocol version Marshal encodes in, see WithCodecVersion.
+func (dec *Encoder) Version() int {
+	return dec.version
+}
+
+// Flush writes any buffered data to the underlying writer.
+// It does nothing for an encoder without a buffer.
+func (dec *Encoder) Flush() error {
+
+	if dec.err != nil {
+		return dec.err
+	}
+
+	if dec.buf != nil {
+		if err := dec.buf.Flush(); err != nil {
+			dec.err = writeError("flush", err)
+			return dec.err
+		}
+	}
 
+	return nil
 }
 
 // An InvalidEncodeError describes an invalid argument passed to Unmarshal.
@@ -53,36 +147,126 @@ func (e *InvalidEncodeError) Error() string {
 	return "ras: Encode(nil " + e.Type.String() + ")"
 }
 
-func Encode(v interface{}, version int) ([]byte, error) {
+func Encode(v interface{}, version int, opts ...Option) ([]byte, error) {
+	return AppendEncode(nil, v, version, opts...)
+}
+
+// appendWriter is the writer of AppendEncode.
+type appendWriter struct {
+	buf     []byte
+	scratch [16]byte // see scratch
+}
 
-	buf := bytes.NewBuffer([]byte{})
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
 
-	encoder := NewEncoder(buf)
-	err := encoder.Encode(v, version)
-	if err != nil {
-		return buf.Bytes(), err
+// appendEncoder is an Encoder writing to its own appendWriter.
+type appendEncoder struct {
+	Encoder
+	w appendWriter
+}
+
+var appendEncoders = sync.Pool{
+	New: func() interface{} {
+		e := &appendEncoder{}
+		e.writer = &e.w
+		e.setOptions(nil)
+		return e
+	},
+}
+
+// AppendEncode appends the encoding of v to dst and returns the extended buffer.
+// Unlike Encode, it allocates nothing but the growth of dst for most values.
+func AppendEncode(dst []byte, v interface{}, version int, opts ...Option) ([]byte, error) {
+
+	e := appendEncoders.Get().(*appendEncoder)
+	e.w.buf = dst
+	e.err = nil
+	if len(opts) > 0 {
+		e.setOptions(opts)
+	}
+
+	_, err := e.Encode(v, version)
+	dst = e.w.buf
+
+	e.w.buf = nil
+	if len(opts) > 0 {
+		e.setOptions(nil)
 	}
+	appendEncoders.Put(e)
 
-	return buf.Bytes(), nil
+	return dst, err
+}
+
+// Size returns the number of bytes Encode writes for v, so that a frame
+// header can be written before the body. The same fields are visited as
+// by Encode, but nothing is produced: a Marshaller or Formatter that also
+// implements Sizer is asked for its size, any other one encodes to nowhere.
+func Size(v interface{}, version int, opts ...Option) (int, error) {
+
+	encoder := &Encoder{
+		writer: io.Discard,
+		sizing: true,
+	}
+	encoder.setOptions(opts)
 
+	return encoder.Encode(v, version)
 }
 
-func (dec *Encoder) Encode(val interface{}, version int) error {
+// Encode writes the encoding of val and returns the number of bytes written.
+// DefaultVersion stands for the version set by WithCodecVersion.
+//
+// An error that stops the encoding midway leaves the output in an unknown
+// state, so it is kept and returned by every later call to Encode and Flush.
+// An error found before any byte was written, such as a *SchemaError or
+// an unsupported type, is only returned, the encoder stays usable.
+func (dec *Encoder) Encode(val interface{}, version int) (int, error) {
 
 	if dec.err != nil {
-		return dec.err
+		return 0, dec.err
+	}
+
+	if version == DefaultVersion {
+		version = dec.version
 	}
 
 	if val == nil || (reflect.ValueOf(val).Kind() == reflect.Ptr && reflect.ValueOf(val).IsNil()) {
-		return &InvalidEncodeError{reflect.TypeOf(val)}
+		return 0, &InvalidEncodeError{reflect.TypeOf(val)}
 	}
 
 	rValue := reflect.ValueOf(val)
 
-	return dec.encode(rValue, version)
+	// Work on an addressable copy, so that pointer receivers
+	// of Marshaller and Formatter are found on nested values too.
+	rValue = addressable(rValue)
+
+	dec.n = 0
+
+	if err := dec.encode(rValue, version); err != nil {
+		return dec.n, dec.fail(wrapError(err, "encode", typeName(rValue.Type()), 0, ""))
+	}
+
+	return dec.n, nil
 
 }
 
+// fail returns err, keeping it for later calls if output was written.
+func (dec *Encoder) fail(err error) error {
+
+	if dec.n > 0 || isWriteError(err) {
+		dec.err = err
+	}
+
+	return err
+}
+
+// Marshal is like Encode in the version set by WithCodecVersion.
+func (dec *Encoder) Marshal(val interface{}) (int, error) {
+	return dec.Encode(val, dec.version)
+}
+
 func (dec *Encoder) encode(rValue reflect.Value, version int) error {
 
 	var err error
@@ -101,7 +285,8 @@ func (dec *Encoder) encode(rValue reflect.Value, version int) error {
 
 		switch iFace.(type) {
 		case *time.Time, time.Time:
-			_, err := encodeTime(dec.writer, iFace)
+			n, err := dec.fieldEncoder("time", encodeTime)(dec.writer, iFace)
+			dec.n += n
 			if err != nil {
 				return err
 			}
@@ -110,15 +295,12 @@ func (dec *Encoder) encode(rValue reflect.Value, version int) error {
 		}
 	}
 
-	rKind := rType.Kind()
-
-	if rType.Implements(marshallerType) {
-
-		panic("FIXME")
-
-		return err
+	if m, f := marshaller(rValue); m != nil || f != nil {
+		return dec.encodeMarshaller(m, f, version)
 	}
 
+	rKind := rType.Kind()
+
 	switch rKind {
 	case reflect.Struct:
 		err = dec.encodeStruct(rType, rValue, version)
@@ -126,12 +308,84 @@ func (dec *Encoder) encode(rValue reflect.Value, version int) error {
 		err = dec.encodeSlice(rValue, version)
 	case reflect.Ptr:
 		err = dec.encodePtr(rValue, version)
+	case reflect.Interface:
+		err = dec.encodeInterface(rValue, version)
 	default:
 		err = dec.encodeBasic(rType, rValue)
 	}
 	return err
 }
 
+// marshaller returns the Marshaller or Formatter implemented by v.
+// If v is addressable, the methods of its pointer are also considered.
+func marshaller(v reflect.Value) (Marshaller, Formatter) {
+
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, nil
+	}
+
+	if !implementsMarshaller(v.Type()) {
+		if v.Kind() == reflect.Ptr || !v.CanAddr() || !implementsMarshaller(reflect.PtrTo(v.Type())) {
+			return nil, nil
+		}
+		v = v.Addr()
+	}
+
+	if !v.CanInterface() {
+		return nil, nil
+	}
+
+	switch m := v.Interface().(type) {
+	case Marshaller:
+		return m, nil
+	case Formatter:
+		return nil, m
+	}
+
+	return nil, nil
+}
+
+func implementsMarshaller(t reflect.Type) bool {
+	return t.Implements(marshallerType) || t.Implements(formatterType)
+}
+
+func (dec *Encoder) encodeMarshaller(m Marshaller, f Formatter, version int) error {
+
+	if dec.sizing {
+		var v interface{} = f
+		if m != nil {
+			v = m
+		}
+		if sizer, ok := v.(Sizer); ok {
+			n, err := sizer.SizeRAS(version)
+			dec.n += n
+			return err
+		}
+	}
+
+	if m != nil {
+		n, err := m.MarshalRAS(&dec.out, version)
+		dec.n += n
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	data, err := f.FormatRAS(version)
+	if err != nil {
+		return err
+	}
+
+	n, err := writeBuf("formatter", dec.writer, data)
+	dec.n += n
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (dec *Encoder) decodeCustom(v reflect.Value, decodeFn func() interface{}) error {
 
 	value := decodeFn()
@@ -144,107 +398,274 @@ func (dec *Encoder) decodeCustom(v reflect.Value, decodeFn func() interface{}) e
 
 func (dec *Encoder) encodeBasic(rType reflect.Type, v reflect.Value) error {
 
-	rKind := rType.Kind()
-
-	iFace := v.Interface()
+	var n int
+	var err error
 
-	switch rKind {
+	if name, ok := basicCodecs[rType.Kind()]; ok && dec.encoders != nil && v.CanInterface() {
+		n, err = dec.encoders[name](dec.writer, v.Interface())
+		dec.n += n
+		return err
+	}
 
+	// The value is read by its kind rather than through an interface,
+	// which would allocate, so values of named types are encoded too.
+	switch rKind := rType.Kind(); rKind {
 	case reflect.String:
-		_, err := encodeString(dec.writer, iFace)
-		if err != nil {
-			return err
-		}
+		n, err = writeString(dec.writer, v.String())
 	case reflect.Bool:
-		_, err := encodeBool(dec.writer, iFace)
-		if err != nil {
-			return err
+		var val byte = FALSE_BYTE
+		if v.Bool() {
+			val = TRUE_BYTE
 		}
-	case reflect.Int, reflect.Uint, reflect.Int32, reflect.Uint32:
-		_, err := encodeUint32(dec.writer, iFace)
-		if err != nil {
-			return err
+		n, err = writeByte("bool", dec.writer, val)
+	case reflect.Int, reflect.Int32:
+		n, err = writeUint32(dec.writer, uint32(v.Int()))
+	case reflect.Uint, reflect.Uint32:
+		n, err = writeUint32(dec.writer, uint32(v.Uint()))
+	case reflect.Int16:
+		n, err = writeUint16(dec.writer, uint16(v.Int()))
+	case reflect.Uint16:
+		n, err = writeUint16(dec.writer, uint16(v.Uint()))
+	case reflect.Int64:
+		n, err = writeUint64(dec.writer, uint64(v.Int()))
+	case reflect.Uint64:
+		n, err = writeUint64(dec.writer, v.Uint())
+	case reflect.Int8:
+		n, err = writeByte("byte", dec.writer, byte(v.Int()))
+	case reflect.Uint8:
+		n, err = writeByte("byte", dec.writer, byte(v.Uint()))
+	case reflect.Float32:
+		n, err = writeUint32(dec.writer, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		n, err = writeUint64(dec.writer, math.Float64bits(v.Float()))
+	default:
+		return fmt.Errorf("ras: unsupported type: %s", rKind)
+	}
+
+	dec.n += n
+	return err
+}
+
+func (dec *Encoder) encodeStruct(rType reflect.Type, rValue reflect.Value, version int) error {
+
+	plan := dec.registry.cachedPlan(rType)
+	if plan.err != nil {
+		return plan.err
+	}
+
+	for _, codecField := range plan.fields {
+
+		if !codecField.inVersion(version) {
+			continue
 		}
-	case reflect.Int16, reflect.Uint16:
-		_, err := encodeUint16(dec.writer, iFace)
-		if err != nil {
-			return err
+
+		start := dec.n
+		if err := dec.encodeField(plan, codecField, rValue, version); err != nil {
+			return wrapError(err, "encode", "."+codecField.Name, start, codecField.EncoderCodec())
 		}
-	case reflect.Int64, reflect.Uint64:
-		_, err := encodeUint64(dec.writer, iFace)
+	}
+
+	return nil
+}
+
+// encodeField encodes the field of the struct value rValue.
+func (dec *Encoder) encodeField(plan *structPlan, codecField CodecField, rValue reflect.Value, version int) error {
+
+	f := fieldByIndex(rValue, codecField.index, false)
+
+	if codecField.Nullable {
+		null, err := dec.encodeNull(codecField, f)
 		if err != nil {
 			return err
 		}
-	case reflect.Int8, reflect.Uint8:
-		_, err := encodeByte(dec.writer, iFace)
-		if err != nil {
-			return err
+		if null {
+			return nil
 		}
-	case reflect.Float32:
-		_, err := encodeFloat32(dec.writer, iFace)
+	}
+
+	if codecField.discriminates >= 0 {
+		var err error
+		target := fieldByIndex(rValue, plan.fields[codecField.discriminates].index, false)
+		f, err = discriminatorValue(f, target)
 		if err != nil {
 			return err
 		}
-	case reflect.Float64:
-		_, err := encodeFloat64(dec.writer, iFace)
-		if err != nil {
+	}
+
+	if codecField.discrIdx >= 0 {
+		if err := dec.encodeDiscriminated(f, version); err != nil {
 			return err
 		}
-	default:
-		return fmt.Errorf("ras: unsupported type: %s", rKind)
+		return nil
 	}
-	return nil
-}
 
-func (dec *Encoder) encodeStruct(rType reflect.Type, rValue reflect.Value, version int) error {
+	if name := codecField.EncoderCodec(); name != "" {
 
-	fields := getCodecFields(rType)
+		if fn := dec.fieldEncoder(name, codecField.encodeFn); fn != nil {
 
-	for _, codecField := range fields {
-		if codecField.Ignore {
-			continue
-		}
+			var iFace interface{}
+			switch {
+			case f.Kind() == reflect.Ptr && f.IsNil():
+				iFace = reflect.New(f.Type().Elem()).Interface()
+			case f.Kind() != reflect.Ptr && codecField.encodeByPtr && f.CanAddr():
+				// Boxing a pointer does not allocate, boxing the value may.
+				iFace = f.Addr().Interface()
+			default:
+				iFace = f.Interface()
+			}
 
-		if codecField.Version > version {
-			continue
+			n, err := fn(dec.writer, iFace, codecField.opts...)
+			dec.n += n
+			if err != nil {
+				return err
+			}
+			return nil
 		}
 
-		f := rValue.Field(codecField.fieldIdx)
+		return &CodecError{Name: name, Msg: "not found codec func"}
 
-		if codecField.codec != "" {
+	}
 
-			if fn, ok := encoderFunc[codecField.codec]; ok {
+	return dec.encode(f, version)
+}
 
-				iFace := f.Interface()
+// encodeNull writes the null marker of a nullable field.
+// It reports true if the field is nil and nothing else must be written.
+func (dec *Encoder) encodeNull(field CodecField, f reflect.Value) (bool, error) {
 
-				_, err := fn(dec.writer, iFace)
-				if err != nil {
-					return err
-				}
-				continue
-			}
+	if isNil(f) {
+		n, err := dec.writeNull()
+		dec.n += n
+		return true, err
+	}
+
+	if field.nullInline {
+		return false, nil
+	}
+
+	n, err := dec.writeNotNull()
+	dec.n += n
+	return false, err
+}
+
+func (dec *Encoder) encodePtr(value reflect.Value, version int) error {
+
+	elem := value.Elem()
+	if value.IsNil() {
+		// Outside of a nullable field nil has no representation
+		// on the wire, so the zero value is written instead.
+		elem = reflect.New(value.Type().Elem()).Elem()
+	}
+	if err := dec.encode(elem, version); err != nil {
+		return err
+	}
+
+	return nil
+}
 
-			return &TypeDecodeError{codecField.codec, "not found codec func"}
+// encodeInterface writes the registered id of the value's type followed by the value.
+func (dec *Encoder) encodeInterface(value reflect.Value, version int) error {
 
+	id, err := registeredID(value)
+	if err != nil {
+		return err
+	}
+
+	n, err := dec.encodeSize(id)
+	dec.n += n
+	if err != nil {
+		return err
+	}
+
+	return dec.encode(addressable(value.Elem()), version)
+}
+
+// encodeDiscriminated writes the value of an interface field, or the elements
+// of a slice of interfaces, whose type id is held by a discriminator field.
+func (dec *Encoder) encodeDiscriminated(value reflect.Value, version int) error {
+
+	switch {
+	case value.Kind() == reflect.Interface:
+		if _, err := registeredID(value); err != nil {
+			return err
 		}
-		err := dec.encode(f, version)
+		return dec.encode(addressable(value.Elem()), version)
+
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Interface:
+		size := value.Len()
+
+		n, err := dec.encodeSize(size)
+		dec.n += n
 		if err != nil {
 			return err
 		}
 
+		for i := 0; i < size; i++ {
+			start := dec.n
+			if err := dec.encodeDiscriminatedElem(value, i, version); err != nil {
+				return wrapError(err, "encode", fmt.Sprintf("[%d]", i), start, "")
+			}
+		}
+		return nil
 	}
 
-	return nil
+	return &CodecError{Name: "interface", Msg: "discriminator set on " + value.Type().String() + " field"}
 }
 
-func (dec *Encoder) encodePtr(value reflect.Value, version int) error {
+// encodeDiscriminatedElem writes the element i of a slice of interfaces,
+// which must be of the same type as the first element.
+func (dec *Encoder) encodeDiscriminatedElem(value reflect.Value, i int, version int) error {
 
-	elem := value.Elem()
-	if err := dec.encode(elem, version); err != nil {
+	elem := value.Index(i)
+	if _, err := registeredID(elem); err != nil {
 		return err
 	}
 
-	return nil
+	if elem.Elem().Type() != value.Index(0).Elem().Type() {
+		return &CodecError{Name: "interface", Msg: fmt.Sprintf("element is %s, not %s as the discriminator says", elem.Elem().Type(), value.Index(0).Elem().Type())}
+	}
+
+	return dec.encode(addressable(elem.Elem()), version)
+}
+
+// discriminatorValue returns the value to write for a discriminator field:
+// the registered type id of the value held by the interface field target.
+func discriminatorValue(field, target reflect.Value) (reflect.Value, error) {
+
+	if target.Kind() == reflect.Slice {
+		if target.Len() == 0 {
+			return field, nil
+		}
+		target = target.Index(0)
+	}
+
+	if target.Kind() != reflect.Interface || target.IsNil() {
+		return field, nil
+	}
+
+	id, err := registeredID(target)
+	if err != nil {
+		return field, err
+	}
+
+	value := reflect.New(field.Type()).Elem()
+	if !setIntValue(value, id) {
+		return field, &CodecError{Name: "interface", Msg: "discriminator field of type " + field.Type().String() + " is not an integer"}
+	}
+
+	return value, nil
+}
+
+// addressable returns v itself if it is a pointer or addressable, or an addressable copy of v.
+func addressable(v reflect.Value) reflect.Value {
+
+	if v.Kind() == reflect.Ptr || v.CanAddr() {
+		return v
+	}
+
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
 }
 
 func (dec *Encoder) encodeSlice(value reflect.Value, version int) error {
@@ -253,21 +674,64 @@ func (dec *Encoder) encodeSlice(value reflect.Value, version int) error {
 
 	size = value.Len()
 
-	_, err := encodeSize(dec.writer, size)
+	n, err := dec.encodeSize(size)
+	dec.n += n
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < size; i++ {
 
+		start := dec.n
 		elem := value.Index(i)
 
 		err := dec.encode(elem, version)
 		if err != nil {
-			return err
+			return wrapError(err, "encode", fmt.Sprintf("[%d]", i), start, "")
 		}
 
 	}
 
 	return nil
 }
+
+// fieldEncoder returns the encoder of the codec name: the one backed by
+// the CodecWriter of the encoder for a built-in name, or else fn.
+func (dec *Encoder) fieldEncoder(name string, fn TypeEncoderFunc) TypeEncoderFunc {
+
+	if dec.encoders != nil && dec.registry.isBuiltinEncoder(name) {
+		if codecFn, ok := dec.encoders[name]; ok {
+			return codecFn
+		}
+	}
+
+	return fn
+}
+
+func (dec *Encoder) encodeSize(size int) (int, error) {
+
+	if dec.codec != nil {
+		return dec.codec.WriteSize(size, dec.writer)
+	}
+
+	return encodeSize(dec.writer, size)
+}
+
+func (dec *Encoder) writeNull() (int, error) {
+
+	if dec.codec != nil {
+		return dec.codec.WriteNull(dec.writer)
+	}
+
+	return writeNull(dec.writer)
+}
+
+// writeNotNull writes the marker of a nullable field that is set.
+func (dec *Encoder) writeNotNull() (int, error) {
+
+	if dec.codec != nil {
+		return dec.codec.WriteNullableSize(0, dec.writer)
+	}
+
+	return encodeNullableSize(dec.writer, 0)
+}
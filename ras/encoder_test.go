@@ -1,9 +1,14 @@
 package ras
 
 import (
+	"bytes"
+	"errors"
 	"github.com/k0kubun/pp"
 	uuid "github.com/satori/go.uuid"
 	pb "google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -72,3 +77,339 @@ func TestEncode(t *testing.T) {
 
 	}
 }
+
+type priority int
+
+func (p priority) FormatRAS(version int) ([]byte, error) {
+	return []byte{byte(p)}, nil
+}
+
+func TestEncoder_Marshaller(t *testing.T) {
+
+	type document struct {
+		Lock     Lock       `rac:",1"`
+		Locks    []Lock     `rac:",2"`
+		Priority priority   `rac:",3"`
+		Levels   []priority `rac:",4"`
+	}
+
+	lock := Lock{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 7, "msg"}
+	doc := document{
+		Lock:     lock,
+		Locks:    []Lock{lock, lock},
+		Priority: 3,
+		Levels:   []priority{1, 2},
+	}
+
+	want := bytes.NewBuffer([]byte{})
+	if _, err := lock.MarshalRAS(want, 1); err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec()
+	codec.WriteSize(2, want)
+	lock.MarshalRAS(want, 1)
+	lock.MarshalRAS(want, 1)
+	want.Write([]byte{3})
+	codec.WriteSize(2, want)
+	want.Write([]byte{1, 2})
+
+	buf := bytes.NewBuffer([]byte{})
+	enc := NewEncoder(buf)
+	if _, err := enc.Encode(doc, 1); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Errorf("Encode() = %v, want %v", buf.Bytes(), want.Bytes())
+	}
+
+	if enc.n != want.Len() {
+		t.Errorf("Encode() counted %d bytes, want %d", enc.n, want.Len())
+	}
+}
+
+func TestEncode_Nullable(t *testing.T) {
+
+	type optional struct {
+		Kind  *int64  `rac:"int64,1,nullable"`
+		Name  *string `rac:",2,nullable"`
+		Lock  *Lock   `rac:",3,nullable"`
+		Tags  []int   `rac:",4,nullable"`
+		Count *int    `rac:",5"`
+	}
+
+	kind, name := int64(0), ""
+
+	tests := []struct {
+		name string
+		v    optional
+		want []byte
+	}{
+		{
+			"absent",
+			optional{},
+			[]byte{NULL_BYTE, NULL_BYTE, NULL_BYTE, NULL_BYTE, 0, 0, 0, 0},
+		},
+		{
+			"zero",
+			optional{Kind: &kind, Name: &name, Tags: []int{}},
+			nil,
+		},
+		{
+			"set",
+			optional{
+				Kind: &kind,
+				Name: &name,
+				Lock: &Lock{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 1, "msg"},
+				Tags: []int{1, 2},
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			data, err := Encode(tt.v, 1)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			if tt.want != nil && !bytes.Equal(data, tt.want) {
+				t.Errorf("Encode() = %v, want %v", data, tt.want)
+			}
+
+			var got optional
+			if _, err := Decode(data, &got, 1); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			want := tt.v
+			zero := 0
+			want.Count = &zero
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Decode() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestValue_RoundTrip(t *testing.T) {
+
+	type property struct {
+		Name  string `rac:",1"`
+		Value Value  `rac:",2"`
+	}
+
+	values := []struct {
+		t    TypeInterface
+		data interface{}
+	}{
+		{BOOLEAN, true},
+		{BYTE, 7},
+		{SHORT, -2},
+		{INT, 100000},
+		{LONG, int64(1) << 40},
+		{FLOAT, 1.5},
+		{DOUBLE, 2.25},
+		{SIZE, 300},
+		{NULLABLE_SIZE, 70},
+		{STRING, "value"},
+		{UUID, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{TYPE, 3},
+		{ENDPOINT_ID, 1},
+	}
+
+	var props []property
+	for _, v := range values {
+		value, err := NewValue(v.t, v.data)
+		if err != nil {
+			t.Fatalf("NewValue(%s) error = %v", v.t, err)
+		}
+		props = append(props, property{v.t.String(), value})
+	}
+	props = append(props, property{"null", Value{}})
+
+	data, err := Encode(props, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got []property
+	if _, err := Decode(data, &got, 1); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, props) {
+		t.Errorf("Decode() = %+v, want %+v", got, props)
+	}
+
+	if _, err := NewValue(INT, "1"); err == nil {
+		t.Errorf("NewValue(INT, string) error = nil, want error")
+	}
+}
+
+// writeCounter counts the writes made to it and fails once limit bytes are written.
+type writeCounter struct {
+	buf    bytes.Buffer
+	writes int
+	limit  int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+
+	w.writes++
+	if w.limit > 0 && w.buf.Len()+len(p) > w.limit {
+		return 0, io.ErrShortWrite
+	}
+
+	return w.buf.Write(p)
+}
+
+func TestEncoder_Buffered(t *testing.T) {
+
+	src := sessionLicenses{"srv", []licenseInfo{{"rphost", 1560}, {"rmngr", 1541}}}
+
+	want, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	w := &writeCounter{}
+	enc := NewBufferedEncoder(w)
+
+	n, err := enc.Encode(src, 1)
+	if err != nil || n != len(want) {
+		t.Fatalf("Encode() = %d, %v, want %d", n, err, len(want))
+	}
+
+	if w.writes != 0 {
+		t.Errorf("Encode() wrote %d times before Flush", w.writes)
+	}
+
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if w.writes != 1 || !bytes.Equal(w.buf.Bytes(), want) {
+		t.Errorf("Flush() wrote %v in %d writes, want %v in 1", w.buf.Bytes(), w.writes, want)
+	}
+}
+
+func TestEncoder_StickyError(t *testing.T) {
+
+	src := sessionLicenses{"srv", []licenseInfo{{"rphost", 1560}}}
+
+	w := &writeCounter{limit: 6}
+	enc := NewEncoder(w)
+
+	n, err := enc.Encode(src, 1)
+	if !errors.Is(err, io.ErrShortWrite) || n != 6 {
+		t.Fatalf("Encode() = %d, %v, want 6, io.ErrShortWrite", n, err)
+	}
+
+	writes := w.writes
+	if _, again := enc.Encode(src, 1); again != err || w.writes != writes {
+		t.Errorf("Encode() after error = %v with %d more writes, want the first error", again, w.writes-writes)
+	}
+}
+
+func TestEncoder_RejectedValue(t *testing.T) {
+
+	type bad struct {
+		Name string `ras:"1,codec=no-such-codec"`
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+
+	var schemaErr *SchemaError
+	if _, err := enc.Encode(bad{}, 1); !errors.As(err, &schemaErr) {
+		t.Fatalf("Encode() error = %v, want *SchemaError", err)
+	}
+
+	if _, err := enc.Encode(make(chan int), 1); err == nil {
+		t.Fatal("Encode() of a channel error = nil")
+	}
+
+	if _, err := enc.Encode((*bad)(nil), 1); err == nil {
+		t.Fatal("Encode() of a nil pointer error = nil")
+	}
+
+	want, _ := Encode(int32(7), 1)
+	if n, err := enc.Encode(int32(7), 1); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Encode() after rejected values = %d, %v, wrote %v, want %v", n, err, buf.Bytes(), want)
+	}
+}
+
+// blob is a Marshaller that knows its size.
+type blob struct {
+	data      []byte
+	marshaled bool
+}
+
+func (b *blob) MarshalRAS(writer io.Writer, version int) (int, error) {
+
+	b.marshaled = true
+
+	n, err := encodeSize(writer, len(b.data))
+	if err != nil {
+		return n, err
+	}
+
+	m, err := writer.Write(b.data)
+	return n + m, err
+}
+
+func (b *blob) SizeRAS(version int) (int, error) {
+	return len(encodeSizeBytes(len(b.data))) + len(b.data), nil
+}
+
+func encodeSizeBytes(size int) []byte {
+
+	buf := bytes.NewBuffer([]byte{})
+	encodeSize(buf, size)
+	return buf.Bytes()
+}
+
+func TestSize(t *testing.T) {
+
+	type frame struct {
+		Name    string        `rac:",1"`
+		Blob    *blob         `rac:",2"`
+		Removed int64         `rac:",3,removed=2"`
+		Items   []licenseInfo `rac:",4,version=2"`
+		Value   Value         `rac:",5"`
+		Port    *int32        `rac:",6,nullable"`
+	}
+
+	src := frame{
+		Name:  strings.Repeat("x", 200),
+		Blob:  &blob{data: make([]byte, 20000)},
+		Items: []licenseInfo{{"rphost", 1560}, {strings.Repeat("y", 70), 1541}},
+		Value: Value{STRING, "value"},
+	}
+
+	for _, version := range []int{1, 2} {
+
+		src.Blob.marshaled = false
+
+		size, err := Size(&src, version)
+		if err != nil {
+			t.Fatalf("Size() error = %v", err)
+		}
+
+		if src.Blob.marshaled {
+			t.Errorf("Size() marshaled a Sizer")
+		}
+
+		data, err := Encode(&src, version)
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		if size != len(data) {
+			t.Errorf("Size() = %d at version %d, want %d", size, version, len(data))
+		}
+	}
+}
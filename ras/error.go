@@ -1,18 +1,180 @@
 package ras
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 )
 
+// ErrShortBuffer is reported when the input ends in the middle of a value.
+// It matches io.ErrUnexpectedEOF as well.
+var ErrShortBuffer error = shortBufferError{}
+
+// ErrNullExpected is reported for a null marker that is neither NULL_BYTE nor a value.
+var ErrNullExpected = errors.New("ras: null expected")
+
+type shortBufferError struct{}
+
+func (shortBufferError) Error() string {
+	return "ras: short buffer"
+}
+
+func (shortBufferError) Is(target error) bool {
+	return target == io.ErrUnexpectedEOF
+}
+
+// ErrNeedMore is reported by FeedDecoder when the fed bytes end in the middle of a value.
+var ErrNeedMore = errors.New("ras: need more data")
+
+// ErrTrailingBytes is reported when input is left after the value
+// decoded by DecodeAll or a Decoder that disallows trailing bytes.
+var ErrTrailingBytes = errors.New("ras: trailing bytes after value")
+
+// ErrLimitExceeded is wrapped by every *LimitError.
+var ErrLimitExceeded = errors.New("ras: limit exceeded")
+
+// LimitError reports input exceeding one of the decoder Limits.
+type LimitError struct {
+	Limit string // such as "string length"
+	Value int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("ras: %s %d exceeds limit %d", e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// DecoderError is the cause of the Error returned by FeedDecoder
+// when the fed bytes end in the middle of a value.
 type DecoderError struct {
-	fn        string
 	err       error
 	needBytes int
 	readBytes int
 }
 
 func (e *DecoderError) Error() string {
+	return fmt.Sprintf("ras: need at least %d more bytes after %d", e.needBytes, e.readBytes)
+}
+
+func (e *DecoderError) Unwrap() error {
+	return e.err
+}
+
+// NeedBytes returns the minimum number of bytes missing to complete the value.
+func (e *DecoderError) NeedBytes() int {
+	return e.needBytes
+}
+
+// ReadBytes returns the number of bytes that were read before decoding stopped.
+func (e *DecoderError) ReadBytes() int {
+	return e.readBytes
+}
+
+// Error is returned by Encode, Decode and the other calls coding a value
+// when the value fails to code. It tells where the value is, both in
+// the Go value and on the wire, and wraps the cause, such as a CodecError.
+//
+// Offset counts the bytes from the start of the value passed to the call,
+// so it does not depend on what an Encoder or a Decoder coded before.
+// Add Decoder.Offset as it was before the call for the offset in a stream.
+type Error struct {
+	Op     string // "encode" or "decode"
+	Path   string // Go path of the value, such as SessionInfo.Licenses[2].RmngrPort
+	Offset int    // offset of the value from the start of the call
+	Codec  string // codec of the value, if known
+	Err    error
+}
+
+func (e *Error) Error() string {
+
+	var b strings.Builder
+	b.WriteString("ras: " + e.Op + " " + e.Path)
+	if e.Codec != "" {
+		b.WriteString(" (" + e.Codec + ")")
+	}
+	fmt.Fprintf(&b, " at offset %d: %s", e.Offset, causeText(e.Err))
+
+	return b.String()
+}
+
+// causeText returns the message of err without the prefixes
+// that the codec name in Error already tells.
+func causeText(err error) string {
+
+	if typed, ok := err.(*CodecError); ok {
+		return typed.text()
+	}
+
+	return strings.TrimPrefix(err.Error(), "ras: ")
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// wrapError returns err as an *Error of the value at path. If err already is
+// an *Error of a value within, path is prepended to its path.
+func wrapError(err error, op, path string, offset int, codec string) error {
+
+	if e, ok := err.(*Error); ok {
+		wrapped := *e
+		wrapped.Path = path + e.Path
+		return &wrapped
+	}
+
+	if codec == "" {
+		var codecErr *CodecError
+		if errors.As(err, &codecErr) {
+			codec = codecErr.Name
+		}
+	}
+
+	return &Error{Op: op, Path: path, Offset: offset, Codec: codec, Err: err}
+}
+
+// CodecError is the error of a codec: a value it cannot code, input it
+// failed to read or output it failed to write. The calls coding a value
+// return it wrapped in an Error.
+type CodecError struct {
+	Name string // codec name
+	Msg  string
+	Err  error // cause, such as ErrShortBuffer or the error of the writer
+}
+
+func (e *CodecError) Error() string {
+	return "ras: " + e.Name + ": " + e.text()
+}
+
+// text returns the message of e without the codec name.
+func (e *CodecError) text() string {
+
+	if e.Err == nil {
+		return e.Msg
+	}
+
+	return e.Msg + ": " + causeText(e.Err)
+}
+
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+// writeMsg is the Msg of the CodecError of a failed write.
+const writeMsg = "write"
+
+// writeError reports the failed write of the codec name.
+func writeError(name string, err error) error {
+	return &CodecError{Name: name, Msg: writeMsg, Err: err}
+}
 
-	return fmt.Sprintf("encoderFunc: fn<%s> err<%s>", e.fn, e.err.Error())
+// isWriteError reports whether err tells that the writer failed.
+func isWriteError(err error) bool {
 
+	var codecErr *CodecError
+	return errors.As(err, &codecErr) && codecErr.Msg == writeMsg
 }
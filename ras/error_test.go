@@ -0,0 +1,105 @@
+package ras
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type licenseInfo struct {
+	Process   string `rac:",1"`
+	RmngrPort int32  `rac:",2"`
+}
+
+type sessionLicenses struct {
+	Host     string        `rac:",1"`
+	Licenses []licenseInfo `rac:",2"`
+}
+
+func TestDecode_ErrorPath(t *testing.T) {
+
+	src := sessionLicenses{"srv", []licenseInfo{{"rphost", 1560}, {"rmngr", 1541}}}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got sessionLicenses
+	_, err = Decode(data[:len(data)-2], &got, 1)
+
+	var rasErr *Error
+	if !errors.As(err, &rasErr) {
+		t.Fatalf("Decode() error = %v, want *Error", err)
+	}
+
+	// host: 1+3, list size: 1, first license: 1+6+4, second: 1+5
+	want := Error{Op: "decode", Path: "sessionLicenses.Licenses[1].RmngrPort", Offset: 22, Codec: "uint32"}
+	if rasErr.Op != want.Op || rasErr.Path != want.Path || rasErr.Offset != want.Offset || rasErr.Codec != want.Codec {
+		t.Errorf("Decode() error = %+v, want %+v", *rasErr, want)
+	}
+
+	if !errors.Is(err, ErrShortBuffer) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode() error = %v, want ErrShortBuffer", err)
+	}
+}
+
+func TestDecode_ErrNullExpected(t *testing.T) {
+
+	type optional struct {
+		Port *int32 `rac:",1,nullable"`
+	}
+
+	var got optional
+	if _, err := Decode([]byte{0x05, 0, 0, 0, 1}, &got, 1); !errors.Is(err, ErrNullExpected) {
+		t.Errorf("Decode() error = %v, want ErrNullExpected", err)
+	}
+}
+
+func TestError_OffsetPerCall(t *testing.T) {
+
+	src := sessionLicenses{"srv", []licenseInfo{{"rphost", 1560}, {"rmngr", 1541}}}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	stream := append(append([]byte(nil), data...), data[:len(data)-2]...)
+	dec := NewDecoder(stream)
+
+	var got sessionLicenses
+	if _, err := dec.Decode(&got, 1); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	_, err = dec.Decode(&got, 1)
+
+	var rasErr *Error
+	if !errors.As(err, &rasErr) || rasErr.Offset != 22 {
+		t.Fatalf("Decode() error = %v, want *Error at offset 22", err)
+	}
+
+	var codecErr *CodecError
+	if !errors.As(err, &codecErr) || codecErr.Name != "uint32" {
+		t.Errorf("Decode() error = %v, want *CodecError of uint32", err)
+	}
+
+	if _, err := Encode(struct{ C chan int }{}, 1); !errors.As(err, &rasErr) {
+		t.Errorf("Encode() error = %v, want *Error", err)
+	}
+}
+
+func TestError_UnknownCodec(t *testing.T) {
+
+	var codecErr *CodecError
+	if _, err := EncodeValue("no-such-codec", io.Discard, 1); !errors.As(err, &codecErr) || codecErr.Name != "no-such-codec" {
+		t.Errorf("EncodeValue() error = %v, want *CodecError", err)
+	}
+
+	var v int
+	if _, err := DecodeValue("no-such-codec", strings.NewReader(""), &v); !errors.As(err, &codecErr) || codecErr.Name != "no-such-codec" {
+		t.Errorf("DecodeValue() error = %v, want *CodecError", err)
+	}
+}
@@ -0,0 +1,99 @@
+package ras
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// FeedDecoder decodes values from byte chunks pushed into it, for callers
+// that read the network themselves, such as event loops over non-blocking sockets.
+//
+// Decode either returns a whole value or an *Error wrapping a *DecoderError
+// and ErrNeedMore, which tells how many more bytes are needed at least. A partial result
+// consumes no input and leaves the destination untouched, so Decode can
+// simply be called again after the next Feed.
+type FeedDecoder struct {
+	buf []byte
+	dec *Decoder
+
+	// need is the number of bytes that must be buffered before decoding
+	// is tried again, read the number of bytes the last try read.
+	need int
+	read int
+}
+
+// NewFeedDecoder returns a FeedDecoder decoding with the options, see NewDecoder.
+func NewFeedDecoder(opts ...Option) *FeedDecoder {
+	return &FeedDecoder{dec: NewDecoder(nil, opts...)}
+}
+
+// Feed appends a copy of p to the pending input.
+func (d *FeedDecoder) Feed(p []byte) {
+	d.buf = append(d.buf, p...)
+}
+
+// Buffered returns the number of fed bytes not consumed yet.
+func (d *FeedDecoder) Buffered() int {
+	return len(d.buf)
+}
+
+// Decode decodes the next value from the fed bytes. The value is decoded
+// from its start on every try, so a try is only made once at least
+// as many bytes are fed as the previous one was missing.
+func (d *FeedDecoder) Decode(val interface{}, version int) (int, error) {
+
+	rValue := reflect.ValueOf(val)
+	if val == nil || rValue.Kind() != reflect.Ptr || rValue.IsNil() {
+		return 0, &InvalidDecodeError{reflect.TypeOf(val)}
+	}
+
+	if len(d.buf) < d.need {
+		return 0, d.needMore(rValue.Type().Elem())
+	}
+
+	into := reflect.New(rValue.Type().Elem())
+
+	d.dec.Reset(d.buf)
+	n, err := d.dec.Decode(into.Interface(), version)
+	if err != nil {
+		if !isShortInput(err) {
+			return n, err
+		}
+
+		// The reader knows how many bytes its last read lacked,
+		// a Parser running out of data does not.
+		need := 1
+		if r := d.dec.r; (r.err == io.EOF || r.err == io.ErrUnexpectedEOF) && r.short > 0 {
+			need = r.short
+		}
+		d.need = len(d.buf) + need
+		d.read = d.dec.r.offset
+
+		return 0, d.needMore(rValue.Type().Elem())
+	}
+
+	rValue.Elem().Set(into.Elem())
+
+	rest := copy(d.buf, d.buf[d.dec.r.offset:])
+	d.buf = d.buf[:rest]
+	d.need = 0
+
+	return n, nil
+}
+
+func (d *FeedDecoder) needMore(t reflect.Type) error {
+
+	err := &DecoderError{
+		err:       ErrNeedMore,
+		needBytes: d.need - len(d.buf),
+		readBytes: d.read,
+	}
+
+	return &Error{Op: "decode", Path: typeName(t), Offset: d.read, Err: err}
+}
+
+// isShortInput reports whether err tells that the input ended too early.
+func isShortInput(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrShortBuffer)
+}
@@ -0,0 +1,144 @@
+package ras
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFeedDecoder_Decode(t *testing.T) {
+
+	locks := []Lock{
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 1, "first"},
+		{"6ba7b811-9dad-11d1-80b4-00c04fd430c8", 2, "second"},
+	}
+
+	var data []byte
+	for _, lock := range locks {
+		b, err := Encode(lock, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+	}
+
+	feed := NewFeedDecoder()
+
+	var got []Lock
+	for i := 0; i < len(data); i++ {
+		feed.Feed(data[i : i+1])
+
+		var lock Lock
+		_, err := feed.Decode(&lock, 1)
+
+		var decErr *DecoderError
+		switch {
+		case err == nil:
+			got = append(got, lock)
+		case errors.As(err, &decErr) && errors.Is(err, ErrNeedMore):
+			if decErr.NeedBytes() < 1 {
+				t.Fatalf("Decode() NeedBytes = %d, want > 0", decErr.NeedBytes())
+			}
+			if lock != (Lock{}) {
+				t.Fatalf("Decode() modified the value on a partial result: %+v", lock)
+			}
+		default:
+			t.Fatalf("Decode() error = %v", err)
+		}
+	}
+
+	if len(got) != len(locks) || got[0] != locks[0] || got[1] != locks[1] {
+		t.Errorf("Decode() = %+v, want %+v", got, locks)
+	}
+
+	if feed.Buffered() != 0 {
+		t.Errorf("Buffered() = %d, want 0", feed.Buffered())
+	}
+}
+
+func TestFeedDecoder_NeedBytes(t *testing.T) {
+
+	data, err := Encode(Lock{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 1, "first"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed := NewFeedDecoder()
+	feed.Feed(data[:10])
+
+	var lock Lock
+	_, err = feed.Decode(&lock, 1)
+
+	var decErr *DecoderError
+	if !errors.As(err, &decErr) || decErr.NeedBytes() != 6 || decErr.ReadBytes() != 10 {
+		t.Fatalf("Decode() error = %v, want 6 more bytes after 10", err)
+	}
+
+	if feed.Buffered() != 10 {
+		t.Errorf("Buffered() = %d, want 10", feed.Buffered())
+	}
+}
+
+// parseCalls counts the calls of countingParser.ParseRAS.
+var parseCalls int
+
+// countingParser reads one byte.
+type countingParser struct {
+	b byte
+}
+
+func (p *countingParser) ParseRAS(data []byte, version int) (int, error) {
+
+	parseCalls++
+	if len(data) < 1 {
+		return 0, io.ErrShortBuffer
+	}
+
+	p.b = data[0]
+	return 1, nil
+}
+
+func TestFeedDecoder_Resume(t *testing.T) {
+
+	type value struct {
+		P countingParser `ras:"1"`
+		S string         `ras:"2"`
+	}
+
+	text := strings.Repeat("x", 200)
+	data, err := Encode(text, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append([]byte{7}, data...)
+
+	parseCalls = 0
+	feed := NewFeedDecoder()
+
+	var v value
+	if _, err := feed.Decode(&v, 1); !errors.Is(err, ErrNeedMore) {
+		t.Fatalf("Decode() of a short Parser error = %v, want ErrNeedMore", err)
+	}
+
+	for i := range data {
+		feed.Feed(data[i : i+1])
+
+		_, err := feed.Decode(&v, 1)
+		if i < len(data)-1 {
+			if !errors.Is(err, ErrNeedMore) {
+				t.Fatalf("Decode() after %d bytes error = %v, want ErrNeedMore", i+1, err)
+			}
+			continue
+		}
+
+		if err != nil || v.P.b != 7 || v.S != text {
+			t.Fatalf("Decode() = %d, %q, %v", v.P.b, v.S, err)
+		}
+	}
+
+	// Once the size of the string is read, decoding waits for all of it.
+	if parseCalls > 5 {
+		t.Errorf("Decode() decoded %d times for %d fed bytes", parseCalls, len(data))
+	}
+}
@@ -0,0 +1,89 @@
+package ras
+
+import (
+	"bytes"
+	"errors"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// chunkReader returns the bytes of r in chunks of random length.
+type chunkReader struct {
+	r   io.Reader
+	rnd *rand.Rand
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+
+	if n := c.rnd.Intn(4) + 1; len(p) > n {
+		p = p[:n]
+	}
+
+	return c.r.Read(p)
+}
+
+type primitives struct {
+	Bool    bool      `rac:",1"`
+	Byte    byte      `rac:",2"`
+	Short   int16     `rac:",3"`
+	Int     int32     `rac:",4"`
+	Long    int64     `rac:",5"`
+	Float   float32   `rac:",6"`
+	Double  float64   `rac:",7"`
+	String  string    `rac:",8"`
+	UUID    uuid.UUID `rac:"uuid,9"`
+	Time    time.Time `rac:",10"`
+	Size    int       `rac:"size,11"`
+	Strings []string  `rac:",12"`
+}
+
+func TestDecode_Fragmented(t *testing.T) {
+
+	src := primitives{true, 7, -3, 1541, 1 << 40, 1.5, 2.25, "кластер", uuid.NewV4(),
+		time.Date(2021, 3, 4, 5, 6, 7, 8000000, time.UTC), 300, []string{"a", "", "bc"}}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"one byte": iotest.OneByteReader,
+		"chunks": func(r io.Reader) io.Reader {
+			return &chunkReader{r, rand.New(rand.NewSource(1))}
+		},
+	}
+	for name, wrap := range readers {
+		t.Run(name, func(t *testing.T) {
+
+			var got primitives
+			if _, err := NewDecoderFromReader(wrap(bytes.NewReader(data))).Decode(&got, 1); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			got.Time = got.Time.UTC()
+			if !reflect.DeepEqual(got, src) {
+				t.Errorf("Decode() = %+v, want %+v", got, src)
+			}
+
+			// The primitive codecs must not take a short read for the whole value.
+			var u uuid.UUID
+			if _, err := decodeUUID(wrap(bytes.NewReader(src.UUID.Bytes())), &u); err != nil || u != src.UUID {
+				t.Errorf("decodeUUID() = %s, %v, want %s", u, err, src.UUID)
+			}
+
+			for i := 1; i < len(data); i++ {
+				var got primitives
+				_, err := NewDecoderFromReader(wrap(bytes.NewReader(data[:i]))).Decode(&got, 1)
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("Decode() of %d bytes error = %v, want io.ErrUnexpectedEOF", i, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package ras
+
+import (
+	"fmt"
+	"io"
+)
+
+// readChunk is the most a string is allocated ahead of the bytes read for it,
+// so a corrupt size fails at the end of the input instead of allocating it all.
+const readChunk = 64 << 10
+
+// maxPrealloc is the most list elements allocated ahead of decoding them.
+const maxPrealloc = 1024
+
+// Limits bounds what a Decoder accepts from untrusted input.
+// A zero field means no limit.
+type Limits struct {
+	MaxCollectionLen int // elements of a list
+	MaxStringLen     int // bytes of a string or byte slice
+	MaxDepth         int // nesting of structs, lists and interfaces
+	MaxBytes         int // bytes consumed by one call to Decode
+}
+
+// SetLimits sets the limits checked by the following calls to Decode.
+// Exceeding one fails with a *LimitError.
+func (dec *Decoder) SetLimits(limits Limits) {
+	dec.r.limits = limits
+}
+
+// checkLimit returns a *LimitError if value exceeds the limit max.
+func checkLimit(limit string, value, max int) error {
+
+	if max > 0 && value > max {
+		return &LimitError{limit, value, max}
+	}
+
+	return nil
+}
+
+// checkStringLen returns an error if size is not a valid length of a string
+// or a byte slice, or exceeds the MaxStringLen limit of the reader of a Decoder.
+func checkStringLen(r io.Reader, size int) error {
+
+	if size < 0 {
+		return &CodecError{Name: "string", Msg: fmt.Sprintf("invalid size %d", size)}
+	}
+
+	var max int
+	if lr, ok := r.(*reader); ok {
+		max = lr.limits.MaxStringLen
+	}
+
+	return checkLimit("string length", size, max)
+}
+
+// readSized reads size bytes for a string. The buffer grows by readChunk
+// as the bytes arrive rather than being allocated up front. Like readN,
+// it may return the buffer of a Decoder.
+func readSized(r io.Reader, size int) ([]byte, int, error) {
+
+	if err := checkStringLen(r, size); err != nil {
+		return nil, 0, err
+	}
+
+	if size <= readChunk {
+		return readN(r, size)
+	}
+
+	var buf []byte
+	for len(buf) < size {
+		chunk := size - len(buf)
+		if chunk > readChunk {
+			chunk = readChunk
+		}
+
+		buf = append(buf, make([]byte, chunk)...)
+		n, err := io.ReadFull(r, buf[len(buf)-chunk:])
+		if err != nil {
+			return buf[:len(buf)-chunk+n], len(buf) - chunk + n, err
+		}
+	}
+
+	return buf, size, nil
+}
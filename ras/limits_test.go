@@ -0,0 +1,80 @@
+package ras
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecoder_SetLimits(t *testing.T) {
+
+	type node struct {
+		Name     string  `rac:",1"`
+		Children []*node `rac:",2"`
+	}
+
+	src := node{"root", []*node{{"a", []*node{{"b", nil}}}}}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{"none", Limits{}, ""},
+		{"collection", Limits{MaxCollectionLen: 0x7f}, ""},
+		{"string", Limits{MaxStringLen: 3}, "string length"},
+		{"depth", Limits{MaxDepth: 4}, "depth"},
+		{"bytes", Limits{MaxBytes: len(data) - 1}, "bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dec := NewDecoder(data)
+			dec.SetLimits(tt.limits)
+
+			var got node
+			_, err := dec.Decode(&got, 1)
+
+			var limitErr *LimitError
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Decode() error = %v", err)
+			case tt.want != "" && (!errors.As(err, &limitErr) || limitErr.Limit != tt.want):
+				t.Errorf("Decode() error = %v, want %s limit", err, tt.want)
+			case tt.want != "" && !errors.Is(err, ErrLimitExceeded):
+				t.Errorf("Decode() error = %v, want ErrLimitExceeded", err)
+			}
+		})
+	}
+}
+
+func TestDecoder_HostileSize(t *testing.T) {
+
+	// A list of 2^28 strings, the first one of 2^27 bytes, in a few bytes of input.
+	data := []byte{0xff, 0xff, 0xff, 0x7f, 0x7f, 0xff, 0xff, 0x3f, 'x'}
+
+	var list []string
+	if _, err := Decode(data, &list, 1); err == nil {
+		t.Fatalf("Decode() error = nil, want an error")
+	}
+
+	dec := NewDecoder(data)
+	dec.SetLimits(Limits{MaxCollectionLen: 1000})
+
+	if _, err := dec.Decode(&list, 1); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Decode() error = %v, want ErrLimitExceeded", err)
+	}
+
+	stream := NewDecoderFromReader(bytes.NewReader(data[4:]))
+	stream.SetLimits(Limits{MaxStringLen: 1 << 20})
+
+	var s string
+	if _, err := stream.Decode(&s, 1); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Decode() error = %v, want ErrLimitExceeded", err)
+	}
+}
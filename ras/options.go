@@ -1,27 +1,48 @@
 package ras
 
+// CodecOptions configure an Encoder or a Decoder, see NewEncoder and NewDecoder.
 type CodecOptions struct {
 	Reader  CodecReader
 	Writer  CodecWriter
 	Version int
+
+	Registry *Registry
 }
 
+// Option sets a field of CodecOptions.
 type Option func(o *CodecOptions)
 
+// WithCodecReader makes a Decoder read the primitive values with reader.
 func WithCodecReader(reader CodecReader) Option {
 	return func(o *CodecOptions) {
 		o.Reader = reader
 	}
 }
 
+// WithCodecWriter makes an Encoder write the primitive values with writer.
 func WithCodecWriter(writer CodecWriter) Option {
 	return func(o *CodecOptions) {
 		o.Writer = writer
 	}
 }
 
+// DefaultVersion stands for the version set by WithCodecVersion in Encode,
+// Decode and the other calls taking a version. Version 0 is coded as such,
+// without the fields added in later versions.
+const DefaultVersion = -1
+
+// WithCodecVersion sets the protocol version of Encoder.Marshal and Decoder.Unmarshal,
+// and of the calls given DefaultVersion.
 func WithCodecVersion(version int) Option {
 	return func(o *CodecOptions) {
 		o.Version = version
 	}
 }
+
+// WithRegistry makes an Encoder or a Decoder use the codecs of registry
+// instead of those of the default registry.
+func WithRegistry(registry *Registry) Option {
+	return func(o *CodecOptions) {
+		o.Registry = registry
+	}
+}
@@ -0,0 +1,176 @@
+package ras
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// littleEndian is a codec writing 32-bit integers in little-endian order.
+type littleEndian struct {
+	Codec
+}
+
+func (c littleEndian) WriteInt32(val int32, w io.Writer) (int, error) {
+	return c.WriteUint32(uint32(val), w)
+}
+
+func (c littleEndian) WriteUint32(val uint32, w io.Writer) (int, error) {
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], val)
+	return w.Write(b[:])
+}
+
+func (c littleEndian) ReadInt32(r io.Reader) (int32, int, error) {
+
+	val, n, err := c.ReadUint32(r)
+	return int32(val), n, err
+}
+
+func (c littleEndian) ReadUint32(r io.Reader) (uint32, int, error) {
+
+	var b [4]byte
+	n, err := io.ReadFull(r, b[:])
+	return binary.LittleEndian.Uint32(b[:]), n, err
+}
+
+type optionsValue struct {
+	A int32   `ras:"1"`
+	B uint32  `ras:"2,codec=int"`
+	C []int32 `ras:"3"`
+	D string  `ras:"4,version=5"`
+}
+
+func TestOptions_Codec(t *testing.T) {
+
+	v := optionsValue{A: 1, B: 2, C: []int32{3}, D: "d"}
+	codec := littleEndian{NewCodec()}
+
+	want := []byte{
+		1, 0, 0, 0,
+		2, 0, 0, 0,
+		1, 3, 0, 0, 0,
+		1, 'd',
+	}
+
+	data, err := Encode(v, 10, WithCodecWriter(codec))
+	if err != nil || !bytes.Equal(data, want) {
+		t.Fatalf("Encode() = %v, %v, want %v", data, err, want)
+	}
+
+	// The options do not stay with the pooled encoder.
+	if data, _ := Encode(v, 10); bytes.Equal(data, want) {
+		t.Errorf("Encode() without options = %v, want big-endian integers", data)
+	}
+
+	var got optionsValue
+	if _, err := DecodeAll(data, &got, 10, WithCodecReader(codec)); err != nil || !reflect.DeepEqual(got, v) {
+		t.Errorf("DecodeAll() = %+v, %v, want %+v", got, err, v)
+	}
+}
+
+func TestOptions_Version(t *testing.T) {
+
+	v := optionsValue{A: 1, B: 2, C: []int32{3}, D: "d"}
+
+	buf := &bytes.Buffer{}
+	encoder := NewEncoder(buf, WithCodecVersion(1))
+	if _, err := encoder.Marshal(v); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := Encode(v, 1)
+	if err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Marshal() = %v, %v, want %v", buf.Bytes(), err, want)
+	}
+
+	var got optionsValue
+	decoder := NewDecoder(want, WithCodecVersion(1))
+	if _, err := decoder.Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	v.D = ""
+	if !reflect.DeepEqual(got, v) || decoder.Version() != 1 {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, v)
+	}
+}
+
+func TestOptions_DefaultVersion(t *testing.T) {
+
+	v := optionsValue{A: 1, B: 2, C: []int32{3}, D: "d"}
+
+	want, err := Encode(v, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Encode(v, DefaultVersion, WithCodecVersion(10))
+	if err != nil || !bytes.Equal(data, want) {
+		t.Fatalf("Encode(DefaultVersion) = %v, %v, want %v", data, err, want)
+	}
+
+	if n, err := Size(v, DefaultVersion, WithCodecVersion(10)); err != nil || n != len(want) {
+		t.Errorf("Size(DefaultVersion) = %d, %v, want %d", n, err, len(want))
+	}
+
+	var got optionsValue
+	if _, err := DecodeAll(data, &got, DefaultVersion, WithCodecVersion(10)); err != nil || !reflect.DeepEqual(got, v) {
+		t.Errorf("DecodeAll(DefaultVersion) = %+v, %v, want %+v", got, err, v)
+	}
+
+	// Version 0 is a version of its own, without the fields added later.
+	want, err = Encode(optionsValue{A: 1, B: 2, C: []int32{3}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := Encode(v, 0, WithCodecVersion(10)); err != nil || !bytes.Equal(data, want) {
+		t.Errorf("Encode(version 0) = %v, %v, want %v", data, err, want)
+	}
+}
+
+func TestOptions_CodecValue(t *testing.T) {
+
+	type property struct {
+		Value Value `ras:"1"`
+	}
+
+	v := property{Value{INT, int32(5)}}
+	codec := littleEndian{NewCodec()}
+	want := []byte{byte(INT), 5, 0, 0, 0}
+
+	data, err := Encode(v, 10, WithCodecWriter(codec))
+	if err != nil || !bytes.Equal(data, want) {
+		t.Fatalf("Encode() = %v, %v, want %v", data, err, want)
+	}
+
+	var got property
+	if _, err := DecodeAll(data, &got, 10, WithCodecReader(codec)); err != nil || !reflect.DeepEqual(got, v) {
+		t.Errorf("DecodeAll() = %+v, %v, want %+v", got, err, v)
+	}
+}
+
+func TestOptions_CodecUint(t *testing.T) {
+
+	type counter struct {
+		Count uint `ras:"1"`
+		Max   uint `ras:"2,codec=int"`
+	}
+
+	v := counter{Count: 3000000000, Max: 7}
+	codec := NewCodec()
+
+	data, err := Encode(v, 1, WithCodecWriter(codec))
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got counter
+	if _, err := DecodeAll(data, &got, 1, WithCodecReader(codec)); err != nil || got != v {
+		t.Errorf("DecodeAll() = %+v, %v, want %+v", got, err, v)
+	}
+}
@@ -0,0 +1,217 @@
+package ras
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// structPlan is the compiled form of a struct type: the fields that take part
+// in coding, in wire order, with their codec functions already resolved.
+type structPlan struct {
+	fields []CodecField
+	err    error // schema problems of the type, see Validate
+}
+
+// compilePlan compiles the plan for the struct type t. r.mu must be held.
+func (r *Registry) compilePlan(t reflect.Type) *structPlan {
+
+	fields := getCodecFields(t)
+	plan := &structPlan{
+		fields: make([]CodecField, 0, len(fields)),
+	}
+
+	for _, f := range fields {
+		if f.Ignore {
+			continue
+		}
+
+		f.discrIdx = -1
+		f.discriminates = -1
+
+		if name := f.EncoderCodec(); name != "" {
+			f.encodeFn = r.encoders[name]
+			f.encodeByPtr = r.byPointer[name]
+		}
+
+		if f.options != nil {
+			f.opts = []map[string]string{f.options}
+		}
+
+		if name := f.DecoderCodec(); name != "" {
+			f.decodeFn = r.decoders[name]
+		}
+
+		if f.Nullable {
+			f.nullInline = carriesNull(f.DecoderCodec(), t.FieldByIndex(f.index).Type)
+		}
+
+		plan.fields = append(plan.fields, f)
+	}
+
+	for i, f := range plan.fields {
+		if f.Discriminator == "" {
+			continue
+		}
+		for j, d := range plan.fields {
+			if d.Name == f.Discriminator {
+				plan.fields[i].discrIdx = j
+				plan.fields[j].discriminates = i
+			}
+		}
+	}
+
+	if problems := planProblems(t, plan.fields); len(problems) > 0 {
+		plan.err = &SchemaError{Type: t, Problems: problems}
+	}
+
+	return plan
+}
+
+// planProblems returns the schema problems of the compiled fields of the struct type t.
+func planProblems(t reflect.Type, fields []CodecField) []string {
+
+	var problems []string
+	add := func(f CodecField, format string, args ...interface{}) {
+		problems = append(problems, typeName(t)+"."+f.Name+": "+fmt.Sprintf(format, args...))
+	}
+
+	for i, f := range fields {
+
+		for _, p := range f.problems {
+			add(f, "%s", p)
+		}
+
+		if name := f.EncoderCodec(); name != "" && f.encodeFn == nil {
+			add(f, "unknown encoder codec %q", name)
+		}
+
+		if name := f.DecoderCodec(); name != "" && f.decodeFn == nil {
+			add(f, "unknown decoder codec %q", name)
+		}
+
+		if f.Removed != 0 && f.Removed <= f.Version {
+			add(f, "removed in version %d, not after version %d", f.Removed, f.Version)
+		}
+
+		if f.Discriminator != "" {
+			switch {
+			case !isInterfaceKind(t.FieldByIndex(f.index).Type):
+				add(f, "discriminator on a field that is not an interface or a slice of interfaces")
+			case f.discrIdx < 0:
+				add(f, "discriminator field %s not found", f.Discriminator)
+			case !isIntKind(t.FieldByIndex(fields[f.discrIdx].index).Type):
+				add(f, "discriminator field %s is not an integer", f.Discriminator)
+			case f.discrIdx > i:
+				// The decoder needs the type id before the value.
+				add(f, "discriminator field %s comes after the field", f.Discriminator)
+			}
+		}
+
+		if f.order[len(f.order)-1] == 0 {
+			// Untagged fields keep their declaration order.
+			continue
+		}
+
+		for _, prev := range fields[:i] {
+			if reflect.DeepEqual(prev.order, f.order) && overlaps(prev, f) {
+				add(f, "number %d is already used by %s", f.Number, prev.Name)
+			}
+		}
+	}
+
+	return problems
+}
+
+// overlaps reports whether the fields are present in a common protocol version.
+func overlaps(a, b CodecField) bool {
+	return (a.Removed == 0 || b.Version < a.Removed) && (b.Removed == 0 || a.Version < b.Removed)
+}
+
+// isInterfaceKind reports whether t is an interface or a slice of interfaces.
+func isInterfaceKind(t reflect.Type) bool {
+
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Interface
+}
+
+// isIntKind reports whether t, or the type t points to, is an integer.
+func isIntKind(t reflect.Type) bool {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+func typeName(t reflect.Type) string {
+
+	if t.Name() != "" {
+		return t.Name()
+	}
+
+	return t.String()
+}
+
+// carriesNull reports whether values of a field encode the null marker
+// on their own. Strings and nullable sizes start with a nullable size,
+// which is NULL_BYTE for a null value, so they need no separate marker.
+func carriesNull(codec string, t reflect.Type) bool {
+
+	switch codec {
+	case "string", "null-size", "nullable":
+		return true
+	case "":
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return t.Kind() == reflect.String
+	}
+
+	return false
+}
+
+// isNil reports whether v is a nil pointer, slice, map or interface.
+func isNil(v reflect.Value) bool {
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// fieldByIndex returns the nested field of the struct v at index. Nil pointers
+// to embedded structs on the way are allocated if alloc is set; otherwise
+// the zero value of the field is returned.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+
+	if len(index) == 1 {
+		return v.Field(index[0])
+	}
+
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.New(v.Type().Elem().FieldByIndex(index[i:]).Type).Elem()
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
@@ -0,0 +1,140 @@
+package ras
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCachedPlan(t *testing.T) {
+
+	rType := reflect.TypeOf(Lock{})
+
+	plan := defaultRegistry.cachedPlan(rType)
+	if plan != defaultRegistry.cachedPlan(rType) {
+		t.Fatalf("cachedPlan() compiled %s twice", rType)
+	}
+
+	var numbers []int
+	for _, f := range plan.fields {
+		numbers = append(numbers, f.Number)
+	}
+
+	if !reflect.DeepEqual(numbers, []int{1, 2, 3}) {
+		t.Errorf("cachedPlan() field order = %v, want [1 2 3]", numbers)
+	}
+
+	if plan.fields[0].decodeFn == nil || plan.fields[0].encodeFn == nil {
+		t.Errorf("cachedPlan() did not resolve codec %q", plan.fields[0].codec)
+	}
+}
+
+func BenchmarkDecodeLocks(b *testing.B) {
+
+	type locks struct {
+		Items []Lock `rac:",1"`
+	}
+
+	src := locks{Items: make([]Lock, 5000)}
+	for i := range src.Items {
+		src.Items[i] = Lock{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", i, "lock"}
+	}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var dst locks
+		if _, err := Decode(data, &dst, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type InfobaseHeader struct {
+	UUID        string `rac:"uuid,1"`
+	Name        string `rac:",2"`
+	Description string `rac:",3"`
+}
+
+func TestGetCodecFields_Embedded(t *testing.T) {
+
+	type infobaseInfo struct {
+		InfobaseHeader
+	}
+
+	type infobaseSummaryInfo struct {
+		ClusterUUID string `rac:"uuid,4"`
+		*InfobaseHeader
+	}
+
+	type withOffset struct {
+		Count          int `rac:",1"`
+		Last           int `rac:",5"`
+		InfobaseHeader `rac:",offset=1"`
+	}
+
+	type placed struct {
+		First          int `rac:",1"`
+		InfobaseHeader `rac:",2"`
+		Last           int `rac:",3"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{"embedded", infobaseInfo{}, []string{"UUID", "Name", "Description"}},
+		{"embedded pointer", infobaseSummaryInfo{}, []string{"UUID", "Name", "Description", "ClusterUUID"}},
+		{"offset", withOffset{}, []string{"Count", "UUID", "Name", "Description", "Last"}},
+		{"placed", placed{}, []string{"First", "UUID", "Name", "Description", "Last"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var names []string
+			for _, f := range defaultRegistry.cachedPlan(reflect.TypeOf(tt.v)).fields {
+				names = append(names, f.Name)
+			}
+
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("cachedPlan() fields = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode_Embedded(t *testing.T) {
+
+	type infobaseSummaryInfo struct {
+		*InfobaseHeader
+		ClusterUUID string `rac:"uuid,4"`
+	}
+
+	header := &InfobaseHeader{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "base", "test base"}
+	src := infobaseSummaryInfo{header, "6ba7b811-9dad-11d1-80b4-00c04fd430c8"}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got infobaseSummaryInfo
+	if _, err := Decode(data, &got, 1); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, src) {
+		t.Errorf("Decode() = %+v, want %+v", got, src)
+	}
+
+	// A nil embedded pointer is written as zero values.
+	if _, err := Encode(infobaseSummaryInfo{}, 1); err != nil {
+		t.Errorf("Encode() error = %v", err)
+	}
+}
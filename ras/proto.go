@@ -0,0 +1,662 @@
+package ras
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	pb "google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"reflect"
+)
+
+// protoPlan is the compiled form of a message descriptor, see structPlan.
+type protoPlan struct {
+	fields []ProtoField
+	err    error
+}
+
+// cachedProtoPlan returns the plan for the message, compiling it on first use.
+// Plans share the cache of struct plans, so they are reset along with them.
+func (r *Registry) cachedProtoPlan(md protoreflect.MessageDescriptor) *protoPlan {
+
+	if p, ok := r.plans.Load(md); ok {
+		return p.(*protoPlan)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, _ := r.plans.LoadOrStore(md, r.compileProtoPlan(md))
+	return p.(*protoPlan)
+}
+
+// compileProtoPlan compiles the plan for the message. r.mu must be held.
+func (r *Registry) compileProtoPlan(md protoreflect.MessageDescriptor) *protoPlan {
+
+	fields, err := ProtoFields(md)
+	if err != nil {
+		return &protoPlan{err: err}
+	}
+
+	// The codecs are only known to the registry, so they are checked here
+	// rather than in ProtoFields.
+	var problems []string
+	resolve := func(f *ProtoField) {
+		r.resolveProtoField(f)
+		if name := f.EncoderCodec(); name != "" && f.encodeFn == nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: unknown encoder codec %q", md.Name(), f.Name, name))
+		}
+		if name := f.DecoderCodec(); name != "" && f.decodeFn == nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: unknown decoder codec %q", md.Name(), f.Name, name))
+		}
+	}
+
+	for i := range fields {
+		f := &fields[i]
+
+		resolve(f)
+		for j := range f.Cases {
+			resolve(&f.Cases[j])
+		}
+	}
+
+	if len(problems) > 0 {
+		return &protoPlan{err: &SchemaError{Message: md.FullName(), Problems: problems}}
+	}
+
+	return &protoPlan{fields: fields}
+}
+
+func (r *Registry) resolveProtoField(f *ProtoField) {
+
+	if name := f.Encoder(); name != "" {
+		f.encodeFn = r.encoders[name]
+	}
+
+	if name := f.Decoder(); name != "" {
+		f.decodeFn = r.decoders[name]
+	}
+
+	if f.options != nil {
+		f.opts = []map[string]string{f.options}
+	}
+
+	f.nullInline = f.NullInline()
+}
+
+// MarshalProto returns the encoding of the message. Unlike Encode, it needs
+// no struct tags: the fields are walked through the message descriptor and
+// coded as its v8platform.ras.serialize.tags options say, see ProtoFields.
+func MarshalProto(m proto.Message, version int) ([]byte, error) {
+
+	e := appendEncoders.Get().(*appendEncoder)
+	e.w.buf = nil
+	e.err = nil
+
+	_, err := e.EncodeProto(m, version)
+	data := e.w.buf
+
+	e.w.buf = nil
+	appendEncoders.Put(e)
+
+	return data, err
+}
+
+// UnmarshalProto resets the message and decodes data into it, see MarshalProto.
+func UnmarshalProto(data []byte, m proto.Message, version int) (int, error) {
+
+	if m != nil {
+		proto.Reset(m)
+	}
+
+	decoder := NewDecoder(data)
+
+	return decoder.DecodeProto(m, version)
+}
+
+// EncodeProto writes the encoding of the message, see MarshalProto.
+//
+// An empty repeated field cannot be told from an absent one, so it is
+// written as null if the field is nullable. Errors are kept as by Encode.
+func (dec *Encoder) EncodeProto(m proto.Message, version int) (int, error) {
+
+	if dec.err != nil {
+		return 0, dec.err
+	}
+
+	if m == nil {
+		return 0, &InvalidEncodeError{}
+	}
+
+	if version == DefaultVersion {
+		version = dec.version
+	}
+
+	msg := m.ProtoReflect()
+
+	dec.n = 0
+
+	if err := dec.encodeMessage(msg, version); err != nil {
+		return dec.n, dec.fail(wrapError(err, "encode", string(msg.Descriptor().Name()), 0, ""))
+	}
+
+	return dec.n, nil
+}
+
+// EncodeProtoValue writes the encoding of the message to w, see MarshalProto.
+// Handed the writer of an Encoder, as the MarshalRAS method of a message is,
+// it writes with the registry and codecs of that Encoder, see EncodeValue.
+func EncodeProtoValue(w io.Writer, m proto.Message, version int) (int, error) {
+
+	ew, ok := w.(*encoderWriter)
+	if !ok {
+		return NewEncoder(w).EncodeProto(m, version)
+	}
+	enc := ew.enc
+
+	if m == nil {
+		return 0, &InvalidEncodeError{}
+	}
+
+	if version == DefaultVersion {
+		version = enc.version
+	}
+
+	// The count goes on from the value being encoded, so that the offsets
+	// of errors stay those of the call, and is given back to the caller.
+	start := enc.n
+	err := enc.encodeMessage(m.ProtoReflect(), version)
+	n := enc.n - start
+	enc.n = start
+
+	return n, err
+}
+
+func (dec *Encoder) encodeMessage(m protoreflect.Message, version int) error {
+
+	plan := dec.registry.cachedProtoPlan(m.Descriptor())
+	if plan.err != nil {
+		return plan.err
+	}
+
+	for _, f := range plan.fields {
+
+		if !f.inVersion(version) {
+			continue
+		}
+
+		start := dec.n
+		if err := dec.encodeProtoField(m, f, version); err != nil {
+			return wrapError(err, "encode", "."+f.Name, start, f.EncoderCodec())
+		}
+	}
+
+	return nil
+}
+
+func (dec *Encoder) encodeProtoField(m protoreflect.Message, f ProtoField, version int) error {
+
+	if f.Oneof != nil {
+		return dec.encodeOneof(m, f, version)
+	}
+
+	if f.Nullable {
+		// A list or a message is null when it is not set: an empty
+		// list or a nil message. The generated code follows the same rule.
+		fd := f.Field
+		if (fd.IsList() || fd.Message() != nil) && !m.Has(fd) {
+			n, err := dec.writeNull()
+			dec.n += n
+			return err
+		}
+
+		if !f.nullInline {
+			n, err := dec.writeNotNull()
+			dec.n += n
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return dec.encodeProtoValue(f, m.Get(f.Field), version)
+}
+
+// encodeOneof writes the index of the field of the oneof that is set and its value.
+func (dec *Encoder) encodeOneof(m protoreflect.Message, f ProtoField, version int) error {
+
+	index := 0
+	if fd := m.WhichOneof(f.Oneof); fd != nil {
+		for i, c := range f.Cases {
+			if c.Field == fd {
+				index = i + 1
+			}
+		}
+	}
+
+	n, err := dec.encodeSize(index)
+	dec.n += n
+	if err != nil || index == 0 {
+		return err
+	}
+
+	c := f.Cases[index-1]
+
+	start := dec.n
+	if err := dec.encodeProtoValue(c, m.Get(c.Field), version); err != nil {
+		return wrapError(err, "encode", "."+c.Name, start, c.EncoderCodec())
+	}
+
+	return nil
+}
+
+// encodeProtoValue writes the value of the field, which may be a list.
+func (dec *Encoder) encodeProtoValue(f ProtoField, v protoreflect.Value, version int) error {
+
+	if !f.Field.IsList() {
+		return dec.encodeProtoSingular(f, v, version)
+	}
+
+	list := v.List()
+
+	n, err := dec.encodeSize(list.Len())
+	dec.n += n
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		if err := dec.encodeProtoSingular(f, list.Get(i), version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dec *Encoder) encodeProtoSingular(f ProtoField, v protoreflect.Value, version int) error {
+
+	fd := f.Field
+
+	if name := f.Encoder(); name != "" {
+		fn := dec.fieldEncoder(name, f.encodeFn)
+		if fn == nil {
+			return &CodecError{Name: name, Msg: "not found codec func"}
+		}
+
+		n, err := fn(dec.writer, protoInterface(fd, v), f.opts...)
+		dec.n += n
+		return err
+	}
+
+	switch fd.Kind() {
+	case protoreflect.BytesKind:
+		b := v.Bytes()
+
+		n, err := dec.encodeSize(len(b))
+		dec.n += n
+		if err != nil {
+			return err
+		}
+
+		n, err = writeBuf("bytes", dec.writer, b)
+		dec.n += n
+		return err
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// An absent message is written as the empty one.
+		return dec.encodeMessage(v.Message(), version)
+	}
+
+	return &CodecError{Name: fd.Kind().String(), Msg: "unsupported field kind"}
+}
+
+// DecodeProto reads the next message from its input, see MarshalProto.
+// Fields that are not in the version are left as they are.
+func (dec *Decoder) DecodeProto(m proto.Message, version int) (int, error) {
+
+	dec.n = 0
+
+	if version == DefaultVersion {
+		version = dec.version
+	}
+
+	if dec.err != nil {
+		return dec.n, dec.err
+	}
+
+	if m == nil {
+		return dec.n, &InvalidDecodeError{}
+	}
+
+	msg := m.ProtoReflect()
+	if !msg.IsValid() {
+		return dec.n, &InvalidDecodeError{reflect.TypeOf(m)}
+	}
+
+	start := dec.r.offset
+	dec.r.err = nil
+	dec.r.end = start + dec.r.limits.MaxBytes
+	dec.depth = 0
+
+	if err := dec.decodeMessage(msg, version); err != nil {
+		if dec.r.offset == start && dec.r.err == io.EOF {
+			return dec.n, io.EOF
+		}
+		return dec.n, dec.fail(err, string(msg.Descriptor().Name()), start)
+	}
+
+	if dec.disallowTrailing && dec.More() {
+		return dec.n, dec.trailingError(string(msg.Descriptor().Name()), start)
+	}
+
+	return dec.n, nil
+}
+
+// DecodeProtoValue reads a message written by EncodeProtoValue. Handed the
+// reader of a Decoder, as the UnmarshalRAS method of a message is, it reads
+// with the registry, codecs and limits of that Decoder, see DecodeValue.
+func DecodeProtoValue(r io.Reader, m proto.Message, version int) (int, error) {
+
+	rd, ok := r.(*reader)
+	if !ok || rd.dec == nil {
+		return NewDecoderFromReader(r).DecodeProto(m, version)
+	}
+	dec := rd.dec
+
+	if m == nil {
+		return 0, &InvalidDecodeError{}
+	}
+
+	msg := m.ProtoReflect()
+	if !msg.IsValid() {
+		return 0, &InvalidDecodeError{reflect.TypeOf(m)}
+	}
+
+	if version == DefaultVersion {
+		version = dec.version
+	}
+
+	start, n := dec.r.offset, dec.n
+	err := dec.decodeMessage(msg, version)
+	dec.n = n
+
+	return dec.r.offset - start, err
+}
+
+func (dec *Decoder) decodeMessage(m protoreflect.Message, version int) error {
+
+	dec.depth++
+	defer func() { dec.depth-- }()
+
+	if err := checkLimit("depth", dec.depth, dec.r.limits.MaxDepth); err != nil {
+		return err
+	}
+
+	plan := dec.registry.cachedProtoPlan(m.Descriptor())
+	if plan.err != nil {
+		return plan.err
+	}
+
+	for _, f := range plan.fields {
+
+		if !f.inVersion(version) {
+			continue
+		}
+
+		start := dec.r.offset
+		if err := dec.decodeProtoField(m, f, version); err != nil {
+			return wrapError(err, "decode", "."+f.Name, start, f.DecoderCodec())
+		}
+	}
+
+	return nil
+}
+
+func (dec *Decoder) decodeProtoField(m protoreflect.Message, f ProtoField, version int) error {
+
+	if f.Oneof != nil {
+		return dec.decodeOneof(m, f, version)
+	}
+
+	fd := f.Field
+
+	if f.Nullable {
+		null, err := dec.decodeNull(f.CodecField)
+		if err != nil {
+			return err
+		}
+		if null {
+			m.Clear(fd)
+			return nil
+		}
+	}
+
+	if fd.IsList() {
+		size, err := dec.decodeLen()
+		if err != nil {
+			return err
+		}
+
+		list := m.Mutable(fd).List()
+		list.Truncate(0)
+
+		for i := 0; i < size; i++ {
+			v, err := dec.decodeProtoSingular(f, list.NewElement(), version)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+
+		return nil
+	}
+
+	return dec.decodeProtoInto(m, f, version)
+}
+
+// decodeOneof reads the index of the field of the oneof that is set and its value.
+func (dec *Decoder) decodeOneof(m protoreflect.Message, f ProtoField, version int) error {
+
+	index, n, err := dec.readSize()
+	dec.n += n
+	if err != nil {
+		return err
+	}
+
+	if index == 0 {
+		if fd := m.WhichOneof(f.Oneof); fd != nil {
+			m.Clear(fd)
+		}
+		return nil
+	}
+
+	if index > len(f.Cases) {
+		return &CodecError{Name: "oneof", Msg: fmt.Sprintf("no field %d in oneof %s", index, f.Oneof.Name())}
+	}
+
+	c := f.Cases[index-1]
+
+	start := dec.r.offset
+	if err := dec.decodeProtoInto(m, c, version); err != nil {
+		return wrapError(err, "decode", "."+c.Name, start, c.DecoderCodec())
+	}
+
+	return nil
+}
+
+// decodeProtoInto reads a value of the singular field f and sets it in m.
+// A message is decoded in place.
+func (dec *Decoder) decodeProtoInto(m protoreflect.Message, f ProtoField, version int) error {
+
+	var v protoreflect.Value
+	if f.Field.Message() != nil {
+		v = m.Mutable(f.Field)
+	}
+
+	v, err := dec.decodeProtoSingular(f, v, version)
+	if err != nil {
+		return err
+	}
+
+	m.Set(f.Field, v)
+	return nil
+}
+
+// decodeProtoSingular reads a value of the field. A message is decoded into
+// the message of v, which must be mutable; v is ignored for other kinds.
+func (dec *Decoder) decodeProtoSingular(f ProtoField, v protoreflect.Value, version int) (protoreflect.Value, error) {
+
+	fd := f.Field
+
+	if name := f.Decoder(); name != "" {
+		fn := dec.fieldDecoder(name, f.decodeFn)
+		if fn == nil {
+			return v, &CodecError{Name: name, Msg: "not found codec func"}
+		}
+
+		if fd.Message() != nil {
+			into := v.Message().Interface()
+			if fd.Message().FullName() == timestampName {
+				into = &pb.Timestamp{}
+			}
+
+			n, err := fn(dec.r, into, f.opts...)
+			dec.n += n
+			if err != nil {
+				return v, err
+			}
+
+			if t, ok := into.(*pb.Timestamp); ok {
+				setTimestamp(v.Message(), t)
+			}
+			return v, nil
+		}
+
+		into := newProtoScalar(fd)
+
+		n, err := fn(dec.r, into, f.opts...)
+		dec.n += n
+		if err != nil {
+			return v, err
+		}
+
+		return protoScalarValue(fd, into), nil
+	}
+
+	switch fd.Kind() {
+	case protoreflect.BytesKind:
+		// Like a string, the bytes are checked against MaxStringLen only.
+		size, n, err := dec.readSize()
+		dec.n += n
+		if err != nil {
+			return v, err
+		}
+
+		buf, n, err := readSized(dec.r, size)
+		dec.n += n
+		if err != nil {
+			return v, readError("bytes", err)
+		}
+
+		// The buffer may be the one of the Decoder.
+		return protoreflect.ValueOfBytes(append([]byte(nil), buf...)), nil
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return v, dec.decodeMessage(v.Message(), version)
+	}
+
+	return v, &CodecError{Name: fd.Kind().String(), Msg: "unsupported field kind"}
+}
+
+// protoInterface returns the value of the field as the codecs take it.
+func protoInterface(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return int32(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if fd.Message().FullName() == timestampName {
+			return timestamp(v.Message())
+		}
+		return v.Message().Interface()
+	}
+
+	return v.Interface()
+}
+
+// timestamp returns the google.protobuf.Timestamp message m,
+// which may be a dynamic one, as a Go value.
+func timestamp(m protoreflect.Message) *pb.Timestamp {
+
+	if t, ok := m.Interface().(*pb.Timestamp); ok {
+		return t
+	}
+
+	fds := m.Descriptor().Fields()
+	return &pb.Timestamp{
+		Seconds: m.Get(fds.ByNumber(1)).Int(),
+		Nanos:   int32(m.Get(fds.ByNumber(2)).Int()),
+	}
+}
+
+func setTimestamp(m protoreflect.Message, t *pb.Timestamp) {
+
+	fds := m.Descriptor().Fields()
+	m.Set(fds.ByNumber(1), protoreflect.ValueOfInt64(t.GetSeconds()))
+	m.Set(fds.ByNumber(2), protoreflect.ValueOfInt32(t.GetNanos()))
+}
+
+// newProtoScalar returns a pointer to a Go value of the field kind for a codec to decode into.
+func newProtoScalar(fd protoreflect.FieldDescriptor) interface{} {
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return new(bool)
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return new(int32)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return new(uint32)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return new(int64)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return new(uint64)
+	case protoreflect.FloatKind:
+		return new(float32)
+	case protoreflect.DoubleKind:
+		return new(float64)
+	case protoreflect.StringKind:
+		return new(string)
+	}
+
+	return new([]byte)
+}
+
+func protoScalarValue(fd protoreflect.FieldDescriptor, p interface{}) protoreflect.Value {
+
+	switch p := p.(type) {
+	case *bool:
+		return protoreflect.ValueOfBool(*p)
+	case *int32:
+		if fd.Kind() == protoreflect.EnumKind {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(*p))
+		}
+		return protoreflect.ValueOfInt32(*p)
+	case *uint32:
+		return protoreflect.ValueOfUint32(*p)
+	case *int64:
+		return protoreflect.ValueOfInt64(*p)
+	case *uint64:
+		return protoreflect.ValueOfUint64(*p)
+	case *float32:
+		return protoreflect.ValueOfFloat32(*p)
+	case *float64:
+		return protoreflect.ValueOfFloat64(*p)
+	case *string:
+		return protoreflect.ValueOfString(*p)
+	case *[]byte:
+		return protoreflect.ValueOfBytes(*p)
+	}
+
+	return protoreflect.Value{}
+}
@@ -0,0 +1,302 @@
+package ras
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"sort"
+
+	// The options of a descriptor are only decoded with the descriptor package linked in.
+	_ "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtoTagsNumber is the field number of the v8platform.ras.serialize.tags
+// extension of google.protobuf.FieldOptions and google.protobuf.OneofOptions.
+//
+// The option holds struct tags, as injected into generated Go code:
+//
+//	string uuid = 1 [(v8platform.ras.serialize.tags) = 'ras:"1,version=5,decoder=string"'];
+//
+// The tag of the ras namespace, or else of the rac namespace, is parsed
+// like the tags of Go structs. A field without one is coded in the order
+// of its field number with the default codec of its kind.
+const ProtoTagsNumber protoreflect.FieldNumber = 847939
+
+// timestampName is the message coded with the time codec.
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+// ProtoField is a field or a oneof of a message, in wire order.
+//
+// A oneof is written as the size-encoded index of the field that is set,
+// starting from 1, or 0 if none is, followed by the value of that field.
+type ProtoField struct {
+	CodecField
+
+	Field protoreflect.FieldDescriptor // nil for a oneof
+	Oneof protoreflect.OneofDescriptor // nil for a field
+	Cases []ProtoField                 // fields of a oneof, in declaration order
+}
+
+// ProtoTags returns the value of the tags option held by the options of a field
+// or a oneof. The option may be a known extension, a dynamic one or still
+// unparsed in the unknown fields.
+func ProtoTags(opts proto.Message) string {
+
+	if opts == nil {
+		return ""
+	}
+
+	m := opts.ProtoReflect()
+	if !m.IsValid() {
+		return ""
+	}
+
+	var tags string
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsExtension() && fd.Number() == ProtoTagsNumber && fd.Kind() == protoreflect.StringKind {
+			tags = v.String()
+			return false
+		}
+		return true
+	})
+	if tags != "" {
+		return tags
+	}
+
+	b := m.GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			break
+		}
+		b = b[n:]
+
+		if num == ProtoTagsNumber && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				break
+			}
+			tags = string(v)
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			break
+		}
+		b = b[n:]
+	}
+
+	return tags
+}
+
+// ProtoFields returns the fields and oneofs of the message in wire order.
+// Ignored fields are left out.
+func ProtoFields(md protoreflect.MessageDescriptor) ([]ProtoField, error) {
+
+	var fields []ProtoField
+
+	fds := md.Fields()
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			if od.Fields().Get(0) != fd {
+				continue
+			}
+			f, err := protoOneof(od)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", md.FullName(), err)
+			}
+			if !f.Ignore {
+				fields = append(fields, f)
+			}
+			continue
+		}
+
+		f, err := protoField(fd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", md.FullName(), err)
+		}
+		if !f.Ignore {
+			fields = append(fields, f)
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Number < fields[j].Number
+	})
+
+	if problems := protoProblems(md, fields); len(problems) > 0 {
+		return nil, &SchemaError{Message: md.FullName(), Problems: problems}
+	}
+
+	return fields, nil
+}
+
+// protoProblems returns the schema problems of the fields of the message,
+// as planProblems does for the fields of a struct.
+func protoProblems(md protoreflect.MessageDescriptor, fields []ProtoField) []string {
+
+	var problems []string
+	add := func(f ProtoField, format string, args ...interface{}) {
+		problems = append(problems, string(md.Name())+"."+f.Name+": "+fmt.Sprintf(format, args...))
+	}
+
+	for i, f := range fields {
+
+		if f.Removed != 0 && f.Removed <= f.Version {
+			add(f, "removed in version %d, not after version %d", f.Removed, f.Version)
+		}
+
+		// Messages have no integer type ids to select the type of a value by.
+		if f.Discriminator != "" {
+			add(f, "discriminator is not supported")
+		}
+
+		if f.Oneof != nil && f.Nullable {
+			add(f, "nullable oneofs are not supported")
+		}
+
+		for _, prev := range fields[:i] {
+			if prev.Number == f.Number && overlaps(prev.CodecField, f.CodecField) {
+				add(f, "number %d is already used by %s", f.Number, prev.Name)
+			}
+		}
+	}
+
+	return problems
+}
+
+func protoField(fd protoreflect.FieldDescriptor) (ProtoField, error) {
+
+	if fd.IsMap() {
+		return ProtoField{}, fmt.Errorf("%s: map fields are not supported", fd.Name())
+	}
+
+	codecField, err := parseProtoTag(fd.Options(), string(fd.Name()), int(fd.Number()))
+	if err != nil {
+		return ProtoField{}, err
+	}
+
+	return ProtoField{CodecField: codecField, Field: fd}, nil
+}
+
+// protoOneof returns the oneof as a field numbered, unless its tag says
+// otherwise, after the lowest number of its fields.
+func protoOneof(od protoreflect.OneofDescriptor) (ProtoField, error) {
+
+	fds := od.Fields()
+
+	number := int(fds.Get(0).Number())
+	cases := make([]ProtoField, 0, fds.Len())
+	for i := 0; i < fds.Len(); i++ {
+		f, err := protoField(fds.Get(i))
+		if err != nil {
+			return ProtoField{}, err
+		}
+		if int(f.Field.Number()) < number {
+			number = int(f.Field.Number())
+		}
+		cases = append(cases, f)
+	}
+
+	codecField, err := parseProtoTag(od.Options(), string(od.Name()), number)
+	if err != nil {
+		return ProtoField{}, err
+	}
+
+	return ProtoField{CodecField: codecField, Oneof: od, Cases: cases}, nil
+}
+
+func parseProtoTag(opts proto.Message, name string, number int) (CodecField, error) {
+
+	tag := reflect.StructTag(ProtoTags(opts))
+
+	namespace := RasTagNamespace
+	value, ok := tag.Lookup(namespace)
+	if !ok {
+		namespace = TagNamespace
+		value = tag.Get(namespace)
+	}
+
+	f, err := ParseTag(namespace, value)
+	if err != nil {
+		return f, fmt.Errorf("%s: %w", name, err)
+	}
+
+	f.Name = name
+	if f.Number == 0 {
+		f.Number = number
+	}
+
+	return f, nil
+}
+
+// Encoder returns the codec that writes a value of the field: the codec of
+// its tag or the default codec of its kind. It is empty for oneofs, bytes
+// and messages other than timestamps, which are written by their structure.
+func (f ProtoField) Encoder() string {
+
+	if codec := f.EncoderCodec(); codec != "" {
+		return codec
+	}
+
+	return ProtoKindCodec(f.Field)
+}
+
+// Decoder returns the codec that reads a value of the field, see Encoder.
+func (f ProtoField) Decoder() string {
+
+	if codec := f.DecoderCodec(); codec != "" {
+		return codec
+	}
+
+	return ProtoKindCodec(f.Field)
+}
+
+// NullInline reports whether the value of a nullable field
+// carries the null marker itself.
+func (f ProtoField) NullInline() bool {
+
+	switch f.Decoder() {
+	case "string", "null-size", "nullable":
+		return true
+	}
+
+	return false
+}
+
+// ProtoKindCodec returns the codec of the values of the field kind.
+func ProtoKindCodec(fd protoreflect.FieldDescriptor) string {
+
+	if fd == nil {
+		return ""
+	}
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return "bool"
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64"
+	case protoreflect.FloatKind:
+		return "float32"
+	case protoreflect.DoubleKind:
+		return "float64"
+	case protoreflect.StringKind:
+		return "string"
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == timestampName {
+			return "time"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,158 @@
+package ras
+
+import (
+	"errors"
+	"github.com/v8platform/encoder/internal/prototag"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func loadImage(t *testing.T, name protoreflect.FullName) protoreflect.MessageDescriptor {
+
+	data, err := os.ReadFile("../image.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := prototag.UnmarshalSet(data)
+	if err != nil {
+		t.Fatalf("UnmarshalSet() error = %v", err)
+	}
+
+	files, err := prototag.NewFiles(set)
+	if err != nil {
+		t.Fatalf("NewFiles() error = %v", err)
+	}
+
+	d, err := files.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d.(protoreflect.MessageDescriptor)
+}
+
+func TestProtoFields_Image(t *testing.T) {
+
+	fields, err := ProtoFields(loadImage(t, "v8platform.ras.serialize.SessionInfo"))
+	if err != nil {
+		t.Fatalf("ProtoFields() error = %v", err)
+	}
+
+	uuid := fields[0]
+	if uuid.Name != "uuid" || uuid.Version != 5 || uuid.Decoder() != "string" || uuid.Encoder() != "string" {
+		t.Errorf("ProtoFields()[0] = %+v, want uuid from version 5 decoded with string", uuid.CodecField)
+	}
+
+	for i, f := range fields {
+		if f.Number != i+1 {
+			t.Errorf("ProtoFields()[%d] = %s number %d, want %d", i, f.Name, f.Number, i+1)
+		}
+	}
+
+	started := fields[9]
+	if started.Name != "started_at" || started.Encoder() != "time" {
+		t.Errorf("ProtoFields()[9] = %s coded with %q, want started_at coded with time", started.Name, started.Encoder())
+	}
+}
+
+func TestProtoFields_Problems(t *testing.T) {
+
+	tags := func(opts proto.Message, tag string) {
+		b := protowire.AppendTag(nil, ProtoTagsNumber, protowire.BytesType)
+		opts.ProtoReflect().SetUnknown(protowire.AppendString(b, tag))
+	}
+
+	field := func(name string, number int32, tag string) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if tag != "" {
+			fd.Options = &descriptorpb.FieldOptions{}
+			tags(fd.Options, tag)
+		}
+		return fd
+	}
+
+	replaced := field("new", 2, `ras:"1,version=4"`)
+	text := field("text", 6, "")
+	text.OneofIndex = proto.Int32(0)
+	choice := &descriptorpb.OneofDescriptorProto{Name: proto.String("choice"), Options: &descriptorpb.OneofOptions{}}
+	tags(choice.Options, `ras:"6,nullable"`)
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/problems.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Bad"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("old", 1, `ras:"1,removed=4"`),
+				replaced,
+				field("id", 3, ""),
+				field("dup", 4, `ras:"3,version=2"`),
+				field("range", 5, `ras:"5,version=5,removed=5"`),
+				text,
+				field("kind", 7, `ras:"7,discriminator=id"`),
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{choice},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := fd.Messages().Get(0)
+	_, err = ProtoFields(md)
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("ProtoFields() error = %v, want *SchemaError", err)
+	}
+
+	want := []string{
+		"Bad.dup: number 3 is already used by id",
+		"Bad.range: removed in version 5, not after version 5",
+		"Bad.choice: nullable oneofs are not supported",
+		"Bad.kind: discriminator is not supported",
+	}
+
+	if schemaErr.Message != "test.Bad" || !reflect.DeepEqual(schemaErr.Problems, want) {
+		t.Errorf("ProtoFields() error = %s %q, want test.Bad %q", schemaErr.Message, schemaErr.Problems, want)
+	}
+
+	if _, err := MarshalProto(dynamicpb.NewMessage(md), 10); !errors.As(err, &schemaErr) {
+		t.Errorf("MarshalProto() error = %v, want *SchemaError", err)
+	}
+
+	// The codecs are checked against the registry when the message is coded.
+	unknown, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/unknown.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:  proto.String("Unknown"),
+			Field: []*descriptorpb.FieldDescriptorProto{field("count", 1, `ras:"1,encoder=no-such-codec"`)},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MarshalProto(dynamicpb.NewMessage(unknown.Messages().Get(0)), 10)
+	if !errors.As(err, &schemaErr) || !reflect.DeepEqual(schemaErr.Problems, []string{`Unknown.count: unknown encoder codec "no-such-codec"`}) {
+		t.Errorf("MarshalProto() error = %v, want an unknown encoder codec", err)
+	}
+}
@@ -0,0 +1,300 @@
+package ras
+
+import (
+	"bytes"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	pb "google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+// frameFile declares
+//
+//	enum Kind { KIND_NONE = 0; KIND_LOCK = 1; }
+//	message Item { string name = 1; }
+//	message Frame {
+//	  string name = 1 [(tags) = 'ras:"1,nullable"'];
+//	  int32 count = 2;
+//	  Kind kind = 3;
+//	  bytes data = 4;
+//	  repeated Item items = 5;
+//	  Item item = 6 [(tags) = 'ras:"6,nullable"'];
+//	  google.protobuf.Timestamp at = 7;
+//	  string id = 8 [(tags) = 'ras:"8,version=5"'];
+//	  oneof choice { string text = 9; Item sub = 10; }
+//	}
+func frameFile(t *testing.T) protoreflect.FileDescriptor {
+
+	tags := func(tag string) *descriptorpb.FieldOptions {
+		b := protowire.AppendTag(nil, ProtoTagsNumber, protowire.BytesType)
+		opts := &descriptorpb.FieldOptions{}
+		opts.ProtoReflect().SetUnknown(protowire.AppendString(b, tag))
+		return opts
+	}
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typeName != "" {
+			fd.TypeName = proto.String(typeName)
+		}
+		return fd
+	}
+
+	name := field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	name.Options = tags(`ras:"1,nullable"`)
+	items := field("items", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Item")
+	items.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	item := field("item", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Item")
+	item.Options = tags(`ras:"6,nullable"`)
+	id := field("id", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	id.Options = tags(`ras:"8,version=5"`)
+	text := field("text", 9, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	text.OneofIndex = proto.Int32(0)
+	sub := field("sub", 10, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Item")
+	sub.OneofIndex = proto.Int32(0)
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/frame.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("KIND_NONE"), Number: proto.Int32(0)},
+				{Name: proto.String("KIND_LOCK"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")},
+			},
+			{
+				Name: proto.String("Frame"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					name,
+					field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("kind", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Kind"),
+					field("data", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+					items,
+					item,
+					field("at", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+					id,
+					text,
+					sub,
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}},
+			},
+		},
+	}
+
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd
+}
+
+type frameItem struct {
+	Name string `ras:"1"`
+}
+
+// frame is the struct tagged like the Frame message without a oneof field set.
+type frame struct {
+	Name   string      `ras:"1,nullable"`
+	Count  int32       `ras:"2"`
+	Kind   int32       `ras:"3"`
+	Data   []byte      `ras:"4"`
+	Items  []frameItem `ras:"5"`
+	Item   *frameItem  `ras:"6,nullable"`
+	At     time.Time   `ras:"7"`
+	ID     string      `ras:"8,version=5"`
+	Choice int         `ras:"9,codec=size"`
+}
+
+func newFrame(t *testing.T) (protoreflect.MessageDescriptor, *dynamicpb.Message) {
+
+	md := frameFile(t).Messages().ByName("Frame")
+	m := dynamicpb.NewMessage(md)
+
+	itemMd := md.Fields().ByName("items").Message()
+	newItem := func(name string) protoreflect.Value {
+		item := dynamicpb.NewMessage(itemMd)
+		item.Set(itemMd.Fields().ByName("name"), protoreflect.ValueOfString(name))
+		return protoreflect.ValueOfMessage(item)
+	}
+
+	at := pb.New(time.Date(2021, 3, 4, 5, 6, 7, 8e6, time.UTC))
+	m.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("frame"))
+	m.Set(md.Fields().ByName("count"), protoreflect.ValueOfInt32(-3))
+	m.Set(md.Fields().ByName("kind"), protoreflect.ValueOfEnum(1))
+	m.Set(md.Fields().ByName("data"), protoreflect.ValueOfBytes([]byte{1, 2, 3}))
+	list := m.Mutable(md.Fields().ByName("items")).List()
+	list.Append(newItem("a"))
+	list.Append(newItem("b"))
+	m.Set(md.Fields().ByName("item"), newItem("c"))
+	m.Set(md.Fields().ByName("at"), protoreflect.ValueOfMessage(at.ProtoReflect()))
+	m.Set(md.Fields().ByName("id"), protoreflect.ValueOfString("id"))
+
+	return md, m
+}
+
+func TestMarshalProto_Struct(t *testing.T) {
+
+	_, m := newFrame(t)
+
+	want := frame{
+		Name:  "frame",
+		Count: -3,
+		Kind:  1,
+		Data:  []byte{1, 2, 3},
+		Items: []frameItem{{"a"}, {"b"}},
+		Item:  &frameItem{"c"},
+		At:    time.Date(2021, 3, 4, 5, 6, 7, 8e6, time.UTC),
+		ID:    "id",
+	}
+
+	for _, version := range []int{1, 10} {
+		data, err := MarshalProto(m, version)
+		if err != nil {
+			t.Fatalf("MarshalProto(%d) error = %v", version, err)
+		}
+
+		expected, err := Encode(want, version)
+		if err != nil {
+			t.Fatalf("Encode(%d) error = %v", version, err)
+		}
+
+		if !bytes.Equal(data, expected) {
+			t.Errorf("MarshalProto(%d) = %x, want %x", version, data, expected)
+		}
+	}
+}
+
+func TestMarshalProto_RoundTrip(t *testing.T) {
+
+	md, full := newFrame(t)
+	fds := md.Fields()
+
+	text := proto.Clone(full).(*dynamicpb.Message)
+	text.Set(fds.ByName("text"), protoreflect.ValueOfString("text"))
+
+	sub := proto.Clone(full).(*dynamicpb.Message)
+	sub.Set(fds.ByName("sub"), sub.Get(fds.ByName("item")))
+	sub.Clear(fds.ByName("item"))
+
+	// A timestamp that is not nullable is always written, so it is read back set.
+	empty := dynamicpb.NewMessage(md)
+	empty.Mutable(fds.ByName("at"))
+
+	for name, m := range map[string]*dynamicpb.Message{
+		"empty": empty,
+		"full":  full,
+		"text":  text,
+		"sub":   sub,
+	} {
+		data, err := MarshalProto(m, 10)
+		if err != nil {
+			t.Fatalf("%s: MarshalProto() error = %v", name, err)
+		}
+
+		got := dynamicpb.NewMessage(md)
+		n, err := UnmarshalProto(data, got, 10)
+		if err != nil || n != len(data) {
+			t.Fatalf("%s: UnmarshalProto() = %d, %v, want %d", name, n, err, len(data))
+		}
+
+		if !proto.Equal(got, m) {
+			t.Errorf("%s: UnmarshalProto() = %v, want %v", name, got, m)
+		}
+	}
+
+	// The id is added in version 5.
+	data, err := MarshalProto(full, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := dynamicpb.NewMessage(md)
+	if _, err := UnmarshalProto(data, got, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got.Has(fds.ByName("id")) || !got.Has(fds.ByName("item")) {
+		t.Errorf("UnmarshalProto(version 1) = %v, want no id", got)
+	}
+}
+
+func TestUnmarshalProto_BadOneof(t *testing.T) {
+
+	md, m := newFrame(t)
+
+	data, err := MarshalProto(m, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The oneof index is the last byte of a frame without a oneof field set.
+	data[len(data)-1] = 3
+
+	if _, err := UnmarshalProto(data, dynamicpb.NewMessage(md), 10); err == nil {
+		t.Error("UnmarshalProto() error = nil, want unknown oneof field")
+	}
+}
+
+func TestEncodeProto_RejectedMessage(t *testing.T) {
+
+	b := protowire.AppendTag(nil, ProtoTagsNumber, protowire.BytesType)
+	opts := &descriptorpb.FieldOptions{}
+	opts.ProtoReflect().SetUnknown(protowire.AppendString(b, `ras:"1,discriminator=kind"`))
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/bad.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Bad"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("kind"),
+				JsonName: proto.String("kind"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Options:  opts,
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, m := newFrame(t)
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if _, err := enc.EncodeProto(dynamicpb.NewMessage(fd.Messages().Get(0)), 10); err == nil {
+		t.Fatal("EncodeProto() of a message with a discriminator error = nil")
+	}
+
+	want, err := MarshalProto(m, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enc.EncodeProto(m, 10); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("EncodeProto() after a rejected message = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+}
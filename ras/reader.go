@@ -0,0 +1,195 @@
+package ras
+
+import (
+	"io"
+)
+
+// fillSize is how many bytes a Parser may see at once when decoding from a stream.
+const fillSize = 4096
+
+// reader is the source the Decoder hands to the primitive decoders.
+//
+// It serves bytes from buf first. When buf is drained and src is set,
+// it pulls exactly the bytes that were asked for from src, so a stream
+// is never read past the value being decoded. Bytes fetched ahead
+// for a Parser stay in buf for the next read.
+type reader struct {
+	src    io.Reader
+	buf    []byte
+	off    int // read position in buf
+	offset int // bytes consumed since the reader was created
+	err    error
+	short  int // bytes missing from the last read that hit the end of input
+
+	limits Limits
+	end    int // offset reads must not go past while MaxBytes is set
+
+	dec *Decoder // the Decoder reading, whose codecs DecodeValue uses
+}
+
+func newReader(src io.Reader, buf []byte) *reader {
+	return &reader{
+		src: src,
+		buf: buf,
+	}
+}
+
+// Read fills p completely unless the input ends first, in which case
+// it returns io.EOF if nothing was read and io.ErrUnexpectedEOF otherwise.
+func (r *reader) Read(p []byte) (int, error) {
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if r.limits.MaxBytes > 0 && r.offset+len(p) > r.end {
+		r.err = &LimitError{"bytes", r.offset + len(p) - r.end + r.limits.MaxBytes, r.limits.MaxBytes}
+		return 0, r.err
+	}
+
+	n := copy(p, r.buf[r.off:])
+	r.off += n
+	r.compact()
+
+	var err error
+	if n < len(p) && r.src != nil {
+		var m int
+		m, err = io.ReadFull(r.src, p[n:])
+		n += m
+	}
+
+	r.offset += n
+	r.short = len(p) - n
+
+	switch {
+	case n == len(p):
+		return n, nil
+	case err != nil && err != io.EOF && err != io.ErrUnexpectedEOF:
+		r.err = err
+	case n == 0:
+		r.err = io.EOF
+	default:
+		r.err = io.ErrUnexpectedEOF
+	}
+
+	return n, r.err
+}
+
+// next returns the next n bytes without copying them, if they are buffered
+// and within the limits. The bytes are only valid until the next read.
+func (r *reader) next(n int) ([]byte, bool) {
+
+	if len(r.buf)-r.off < n || (r.limits.MaxBytes > 0 && r.offset+n > r.end) {
+		return nil, false
+	}
+
+	p := r.buf[r.off : r.off+n]
+	r.off += n
+	r.offset += n
+
+	return p, true
+}
+
+// readN reads n bytes from r. The bytes of a Decoder are returned
+// straight from its buffer when they are there.
+func readN(r io.Reader, n int) ([]byte, int, error) {
+
+	if rr, ok := r.(*reader); ok {
+		if p, ok := rr.next(n); ok {
+			return p, n, nil
+		}
+	}
+
+	buf := make([]byte, n)
+	m, err := io.ReadFull(r, buf)
+	return buf, m, err
+}
+
+// ReadByte implements io.ByteReader.
+func (r *reader) ReadByte() (byte, error) {
+
+	var b [1]byte
+	if _, err := r.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// peekByte returns the next byte without consuming it.
+func (r *reader) peekByte() (byte, error) {
+
+	if r.off < len(r.buf) {
+		return r.buf[r.off], nil
+	}
+
+	var b [1]byte
+	if _, err := r.Read(b[:]); err != nil {
+		return 0, err
+	}
+
+	// The buffer was drained, so the byte came from the stream:
+	// keep it as the only unread byte.
+	r.offset--
+	r.buf = append(r.buf[:0], b[0])
+	r.off = 0
+
+	return b[0], nil
+}
+
+// buffered returns the unread bytes. If none are left and the reader has
+// a stream behind it, it first reads whatever the stream has available.
+func (r *reader) buffered() ([]byte, error) {
+
+	if r.off < len(r.buf) || r.src == nil {
+		return r.limited(r.buf[r.off:]), nil
+	}
+
+	if cap(r.buf) < fillSize {
+		r.buf = make([]byte, 0, fillSize)
+	}
+
+	n, err := r.src.Read(r.buf[:cap(r.buf)])
+	r.buf = r.buf[:n]
+	r.off = 0
+
+	if n > 0 {
+		return r.limited(r.buf), nil
+	}
+
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	r.err = err
+	return nil, err
+}
+
+// limited cuts the buffered bytes p at the MaxBytes limit.
+func (r *reader) limited(p []byte) []byte {
+
+	if r.limits.MaxBytes > 0 && r.offset+len(p) > r.end {
+		return p[:r.end-r.offset]
+	}
+
+	return p
+}
+
+// discard skips n buffered bytes.
+func (r *reader) discard(n int) {
+
+	if rest := len(r.buf) - r.off; n > rest {
+		n = rest
+	}
+
+	r.off += n
+	r.offset += n
+	r.compact()
+}
+
+// compact releases the drained buffer of a streaming reader,
+// so that its memory is reused by the next fill.
+func (r *reader) compact() {
+	if r.src != nil && r.off == len(r.buf) {
+		r.buf = r.buf[:0]
+		r.off = 0
+	}
+}
@@ -0,0 +1,144 @@
+package ras
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	typesMu  sync.RWMutex
+	idToType = map[int]reflect.Type{}
+	typeToID = map[reflect.Type]int{}
+)
+
+// RegisterType records the concrete type of prototype under id, so that values
+// stored in interface fields can be encoded and decoded.
+//
+// The encoder writes the id of the value's type as its discriminator and the
+// decoder creates a value of the type registered under the id it reads.
+// Register a pointer, such as &Circle{}, to have the decoder store pointers in the interface.
+//
+// The discriminator is either written right before the value or, if the field
+// tag names a discriminator field, taken from that field:
+//
+//	type Figure struct {
+//		Kind  int   `rac:",1"`
+//		Shape Shape `rac:",2,discriminator=Kind"`
+//	}
+//
+// RegisterType panics if id or the type is already registered.
+func RegisterType(id int, prototype interface{}) {
+
+	if prototype == nil {
+		panic("ras: RegisterType of nil prototype")
+	}
+
+	rType := reflect.TypeOf(prototype)
+
+	typesMu.Lock()
+	defer typesMu.Unlock()
+
+	if t, dup := idToType[id]; dup && t != rType {
+		panic(fmt.Sprintf("ras: registering duplicate types for id %d: %s != %s", id, t, rType))
+	}
+
+	if i, dup := typeToID[rType]; dup && i != id {
+		panic(fmt.Sprintf("ras: registering duplicate ids for %s: %d != %d", rType, i, id))
+	}
+
+	idToType[id] = rType
+	typeToID[rType] = id
+}
+
+// typeByID returns the type registered under id.
+func typeByID(id int) (reflect.Type, bool) {
+
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+
+	t, ok := idToType[id]
+	return t, ok
+}
+
+// idByType returns the id the type t is registered under.
+func idByType(t reflect.Type) (int, bool) {
+
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+
+	id, ok := typeToID[t]
+	return id, ok
+}
+
+// newRegistered returns a value of the type registered under id that can be
+// decoded into and then stored in a value of type iface.
+func newRegistered(id int, iface reflect.Type) (reflect.Value, error) {
+
+	t, ok := typeByID(id)
+	if !ok {
+		return reflect.Value{}, &CodecError{Name: "interface", Msg: fmt.Sprintf("no type registered for id %d", id)}
+	}
+
+	if !t.AssignableTo(iface) {
+		return reflect.Value{}, &CodecError{Name: "interface", Msg: fmt.Sprintf("type %s registered for id %d does not implement %s", t, id, iface)}
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()), nil
+	}
+
+	return reflect.New(t).Elem(), nil
+}
+
+// registeredID returns the id of the dynamic type of the interface value v.
+func registeredID(v reflect.Value) (int, error) {
+
+	if v.IsNil() {
+		return 0, &CodecError{Name: "interface", Msg: "nil " + v.Type().String() + " value"}
+	}
+
+	id, ok := idByType(v.Elem().Type())
+	if !ok {
+		return 0, &CodecError{Name: "interface", Msg: fmt.Sprintf("type %s is not registered", v.Elem().Type())}
+	}
+
+	return id, nil
+}
+
+// intValue returns the integer held by v.
+func intValue(v reflect.Value) (int, bool) {
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), true
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return intValue(v.Elem())
+		}
+	}
+
+	return 0, false
+}
+
+// setIntValue stores i in v.
+func setIntValue(v reflect.Value, i int) bool {
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(i))
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(i))
+		return true
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setIntValue(v.Elem(), i)
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package ras
+
+import (
+	"reflect"
+	"testing"
+)
+
+type shape interface {
+	Area() int
+}
+
+type square struct {
+	Side int `rac:",1"`
+}
+
+func (s square) Area() int { return s.Side * s.Side }
+
+type rect struct {
+	Width  int `rac:",1"`
+	Height int `rac:",2"`
+}
+
+func (r *rect) Area() int { return r.Width * r.Height }
+
+func init() {
+	RegisterType(1, square{})
+	RegisterType(2, &rect{})
+}
+
+func TestRegisterType_Interface(t *testing.T) {
+
+	type figure struct {
+		Kind   int     `rac:",1"`
+		Shape  shape   `rac:",2,discriminator=Kind"`
+		Shapes []shape `rac:",3"`
+		Extra  shape   `rac:",4,nullable"`
+		Kinds  byte    `rac:",5"`
+		Same   []shape `rac:",6,discriminator=Kinds"`
+	}
+
+	src := figure{
+		Shape:  &rect{2, 3},
+		Shapes: []shape{square{4}, &rect{5, 6}},
+		Same:   []shape{square{1}, square{2}},
+	}
+
+	data, err := Encode(src, 1)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got figure
+	if _, err := Decode(data, &got, 1); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	want := src
+	want.Kind = 2
+	want.Kinds = 1
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegisterType_Unregistered(t *testing.T) {
+
+	type holder struct {
+		Value interface{} `rac:",1"`
+	}
+
+	if _, err := Encode(holder{Value: 1.5}, 1); err == nil {
+		t.Errorf("Encode() error = nil, want error for unregistered type")
+	}
+
+	var got holder
+	if _, err := Decode([]byte{99}, &got, 1); err == nil {
+		t.Errorf("Decode() error = nil, want error for unknown id")
+	}
+}
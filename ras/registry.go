@@ -0,0 +1,222 @@
+package ras
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Registry holds the named codecs that struct tags refer to and the plans
+// compiled with them. It is safe for concurrent use: codecs may be
+// registered while other goroutines encode and decode.
+//
+// The package-level RegisterEncoderType and RegisterDecoderType extend
+// the default registry, which encoders and decoders use unless they are
+// given another one with WithRegistry. A library that needs codecs of its
+// own under names used elsewhere registers them in a clone:
+//
+//	registry := ras.DefaultRegistry().Clone()
+//	registry.RegisterEncoderType("string", encodeCP1251)
+//	data, err := ras.Encode(v, version, ras.WithRegistry(registry))
+//
+// The registry gives the codecs of the fields tagged with a codec name,
+// such as `ras:"1,codec=string"`, of Value fields and of EncodeValue and
+// DecodeValue called by Marshallers and Unmarshalers. Fields without a
+// codec name are coded by their kind with the built-in codecs, or with
+// those of the CodecWriter and CodecReader, see WithCodecWriter.
+//
+// The types of interface values, see RegisterType, are shared by all registries.
+type Registry struct {
+	mu       sync.RWMutex
+	encoders map[string]TypeEncoderFunc
+	decoders map[string]TypeDecoderFunc
+
+	// byPointer holds the names of the built-in encoders. Besides a value,
+	// they take a pointer to it, which the Encoder passes to spare boxing the value.
+	byPointer map[string]bool
+	// builtinDecoders holds the names of the built-in decoders,
+	// which a CodecReader set on the Decoder replaces.
+	builtinDecoders map[string]bool
+
+	plans sync.Map // map[reflect.Type]*structPlan, map[protoreflect.MessageDescriptor]*protoPlan
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry of the package-level functions.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// NewRegistry returns a registry holding the built-in codecs only.
+func NewRegistry() *Registry {
+
+	r := &Registry{
+		encoders:        map[string]TypeEncoderFunc{},
+		decoders:        map[string]TypeDecoderFunc{},
+		byPointer:       map[string]bool{},
+		builtinDecoders: map[string]bool{},
+	}
+
+	r.RegisterEncoderType("time", encodeTime)
+	r.RegisterEncoderType("type", encodeType)
+	r.RegisterEncoderType("bool", encodeBool)
+	r.RegisterEncoderType("byte int8 uint8", encodeByte)
+	r.RegisterEncoderType("char short int16 uint16", encodeUint16)
+	r.RegisterEncoderType("int int32 uint32", encodeUint32)
+	r.RegisterEncoderType("int64 uint64 long", encodeUint64)
+	r.RegisterEncoderType("float32", encodeFloat32)
+	r.RegisterEncoderType("float64 double", encodeFloat64)
+	r.RegisterEncoderType("string", encodeString)
+	r.RegisterEncoderType("null-size nullable", encodeNullableSize)
+	r.RegisterEncoderType("size", encodeSize)
+	r.RegisterEncoderType("uuid", EncodeUuid)
+
+	r.RegisterDecoderType("time", decodeTime)
+	r.RegisterDecoderType("type", decodeType)
+	r.RegisterDecoderType("bool", decodeBool)
+	r.RegisterDecoderType("byte int8 uint8", decodeByte)
+	r.RegisterDecoderType("char short int16 uint16", decodeUint16)
+	r.RegisterDecoderType("int int32 uint32", decodeUint32)
+	r.RegisterDecoderType("int64 uint64 long", decodeUint64)
+	r.RegisterDecoderType("float32", decodeFloat32)
+	r.RegisterDecoderType("float64 double", decodeFloat64)
+	r.RegisterDecoderType("string", decodeString)
+	r.RegisterDecoderType("null-size nullable", decodeNullableSize)
+	r.RegisterDecoderType("size", decodeSize)
+	r.RegisterDecoderType("bytes", decodeBytes)
+	r.RegisterDecoderType("uuid", decodeUUID)
+
+	for name := range r.encoders {
+		r.byPointer[name] = true
+	}
+
+	for name := range r.decoders {
+		r.builtinDecoders[name] = true
+	}
+
+	return r
+}
+
+// Clone returns a registry holding the codecs of r. Codecs registered
+// later in either registry are not seen by the other.
+func (r *Registry) Clone() *Registry {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := &Registry{
+		encoders:        make(map[string]TypeEncoderFunc, len(r.encoders)),
+		decoders:        make(map[string]TypeDecoderFunc, len(r.decoders)),
+		byPointer:       make(map[string]bool, len(r.byPointer)),
+		builtinDecoders: make(map[string]bool, len(r.builtinDecoders)),
+	}
+
+	for name, fn := range r.encoders {
+		c.encoders[name] = fn
+	}
+	for name, fn := range r.decoders {
+		c.decoders[name] = fn
+	}
+	for name := range r.byPointer {
+		c.byPointer[name] = true
+	}
+	for name := range r.builtinDecoders {
+		c.builtinDecoders[name] = true
+	}
+
+	return c
+}
+
+// RegisterEncoderType registers the encoder under each of the
+// space-separated names, replacing the codecs of those names.
+func (r *Registry) RegisterEncoderType(name string, enc TypeEncoderFunc) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range strings.Fields(strings.ToLower(name)) {
+		r.encoders[s] = enc
+		delete(r.byPointer, s)
+	}
+
+	r.resetPlans()
+}
+
+// RegisterDecoderType registers the decoder under each of the
+// space-separated names, replacing the codecs of those names.
+func (r *Registry) RegisterDecoderType(name string, dec TypeDecoderFunc) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range strings.Fields(strings.ToLower(name)) {
+		r.decoders[s] = dec
+		delete(r.builtinDecoders, s)
+	}
+
+	r.resetPlans()
+}
+
+// EncoderFunc returns the encoder registered under the name.
+func (r *Registry) EncoderFunc(name string) (TypeEncoderFunc, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.encoders[name]
+	return fn, ok
+}
+
+// DecoderFunc returns the decoder registered under the name.
+func (r *Registry) DecoderFunc(name string) (TypeDecoderFunc, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.decoders[name]
+	return fn, ok
+}
+
+// isBuiltinEncoder reports whether the encoder of the name is a built-in one.
+func (r *Registry) isBuiltinEncoder(name string) bool {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.byPointer[name]
+}
+
+// isBuiltinDecoder reports whether the decoder of the name is a built-in one.
+func (r *Registry) isBuiltinDecoder(name string) bool {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.builtinDecoders[name]
+}
+
+// cachedPlan returns the plan for the struct type t, compiling it on first use.
+func (r *Registry) cachedPlan(t reflect.Type) *structPlan {
+
+	if p, ok := r.plans.Load(t); ok {
+		return p.(*structPlan)
+	}
+
+	// The plan is stored under the read lock, so that it cannot outlive
+	// a reset by a codec registered while it is compiled.
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, _ := r.plans.LoadOrStore(t, r.compilePlan(t))
+	return p.(*structPlan)
+}
+
+// resetPlans drops every compiled plan. Plans hold resolved codec functions,
+// so they must be rebuilt after the codec tables change. r.mu must be held.
+func (r *Registry) resetPlans() {
+	r.plans.Range(func(key, _ interface{}) bool {
+		r.plans.Delete(key)
+		return true
+	})
+}
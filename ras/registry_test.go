@@ -0,0 +1,143 @@
+package ras
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type registryValue struct {
+	Name string `ras:"1,codec=name"`
+}
+
+func encodeUpperName(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
+	return encodeString(w, strings.ToUpper(value.(string)))
+}
+
+func encodeLowerName(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
+	return encodeString(w, strings.ToLower(value.(string)))
+}
+
+func TestRegistry_Clone(t *testing.T) {
+
+	upper := NewRegistry()
+	upper.RegisterEncoderType("name", encodeUpperName)
+	upper.RegisterDecoderType("name", decodeString)
+
+	lower := upper.Clone()
+	lower.RegisterEncoderType("name", encodeLowerName)
+
+	v := registryValue{Name: "Name"}
+	for _, tt := range []struct {
+		registry *Registry
+		want     string
+	}{
+		{upper, "NAME"},
+		{lower, "name"},
+	} {
+		data, err := Encode(v, 1, WithRegistry(tt.registry))
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		var got registryValue
+		if _, err := DecodeAll(data, &got, 1, WithRegistry(tt.registry)); err != nil || got.Name != tt.want {
+			t.Errorf("DecodeAll() = %q, %v, want %q", got.Name, err, tt.want)
+		}
+	}
+
+	if _, ok := DefaultRegistry().EncoderFunc("name"); ok {
+		t.Error("DefaultRegistry() has the codec registered in a new registry")
+	}
+
+	if _, err := Encode(v, 1); err == nil {
+		t.Error("Encode() with the default registry error = nil, want unknown codec")
+	}
+
+	if err := lower.Validate(reflect.TypeOf(v)); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+
+	registry := NewRegistry()
+	registry.RegisterEncoderType("name", encodeUpperName)
+	registry.RegisterDecoderType("name", decodeString)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				registry.RegisterEncoderType("name", encodeUpperName)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			encoder := NewEncoder(io.Discard, WithRegistry(registry), WithCodecVersion(1))
+			for j := 0; j < 100; j++ {
+				if _, err := encoder.Marshal(registryValue{Name: "name"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	buf := &bytes.Buffer{}
+	if _, err := NewEncoder(buf, WithRegistry(registry)).Encode(registryValue{Name: "a"}, 1); err != nil || !bytes.HasSuffix(buf.Bytes(), []byte("A")) {
+		t.Errorf("Encode() = %q, %v, want A", buf.Bytes(), err)
+	}
+}
+
+// upperMessage is a Marshaller coding its name as generated code does.
+type upperMessage struct {
+	Name string
+}
+
+func (m upperMessage) MarshalRAS(w io.Writer, version int) (int, error) {
+	return EncodeValue("string", w, m.Name)
+}
+
+func (m *upperMessage) UnmarshalRAS(r io.Reader, version int) (int, error) {
+	return DecodeValue("string", r, &m.Name)
+}
+
+func TestRegistry_Scope(t *testing.T) {
+
+	type scope struct {
+		Plain   string       `ras:"1"`
+		Tagged  string       `ras:"2,codec=string"`
+		Value   Value        `ras:"3"`
+		Message upperMessage `ras:"4"`
+	}
+
+	registry := DefaultRegistry().Clone()
+	registry.RegisterEncoderType("string", encodeUpperName)
+	registry.RegisterDecoderType("string", decodeString)
+
+	v := scope{"plain", "tagged", Value{STRING, "value"}, upperMessage{"message"}}
+	want := scope{"plain", "TAGGED", Value{STRING, "VALUE"}, upperMessage{"MESSAGE"}}
+
+	data, err := Encode(v, 1, WithRegistry(registry))
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got scope
+	if _, err := DecodeAll(data, &got, 1, WithRegistry(registry)); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeAll() = %+v, %v, want %+v", got, err, want)
+	}
+
+	// Outside an Encoder, EncodeValue uses the default registry.
+	buf := &bytes.Buffer{}
+	if _, err := (upperMessage{"message"}).MarshalRAS(buf, 1); err != nil || !bytes.HasSuffix(buf.Bytes(), []byte("message")) {
+		t.Errorf("MarshalRAS() = %q, %v, want message", buf.Bytes(), err)
+	}
+}
@@ -1,23 +1,93 @@
 package ras
 
 import (
-	"log"
+	"fmt"
+	pb "google.golang.org/protobuf/types/known/timestamppb"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const TagNamespace = "rac"
 
+// RasTagNamespace is the namespace of the tags generated from the RAS protobuf schema.
+// It takes precedence over TagNamespace when a field has both.
+const RasTagNamespace = "ras"
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	timestampType = reflect.TypeOf(pb.Timestamp{})
+)
+
 type CodecField struct {
+	Name     string // Go field name
 	Number   int
 	Ignore   bool
-	Version  int
+	Version  int  // first protocol version with the field
+	Removed  int  // first protocol version without the field, 0 if never removed
+	Nullable bool // nil is written as NULL_BYTE and read back as nil
+
+	// Offset shifts the numbers of the fields of an embedded struct
+	// into the numbering space of the parent.
+	Offset int
+
+	// Discriminator names the field holding the registered type id
+	// of the value stored in this interface field.
+	Discriminator string
+
 	codec    string
+	encoder  string
+	decoder  string
+	options  map[string]string // options passed through to the codecs
 	fieldIdx int
+	index    []int // index sequence for reflect.Value.FieldByIndex
+	order    []int // sort key of the field in wire order
+	hasOff   bool
+
+	problems []string // malformed tag values, see Validate
+
+	nullInline    bool // the value carries the null marker itself
+	discrIdx      int  // plan position of the discriminator field, or -1
+	discriminates int  // plan position of the interface field this field discriminates, or -1
+
+	encodeFn    TypeEncoderFunc
+	decodeFn    TypeDecoderFunc
+	encodeByPtr bool                // encodeFn also takes a pointer to the value
+	opts        []map[string]string // options as the variadic argument of the codecs
 }
 
+// getCodecFields returns the fields of the struct type in wire order.
+//
+// The fields of an embedded struct are flattened into the parent like
+// encoding/json does. They keep their own numbering space and take the place
+// of the embedded field, unless its tag sets an offset: then their numbers
+// are shifted by it and merged with the numbers of the parent.
+//
+//	type Header struct {
+//		UUID string `rac:"uuid,1"`
+//		Name string `rac:",2"`
+//	}
+//
+//	type Summary struct {
+//		Header              // UUID, Name, then Cluster
+//		Cluster string `rac:"uuid,3"`
+//	}
+//
+//	type Info struct {
+//		Count  int    `rac:",1"`
+//		Header `rac:",offset=1"` // UUID is number 2, Name is number 3
+//	}
+//
+// A field is coded in the versions from its version up to, but not
+// including, the version it was removed in. The fields of an embedded
+// struct are limited to the range of the embedded field:
+//
+//	type Session struct {
+//		Host    string `rac:",1"`
+//		License string `rac:",2,version=4,removed=9"` // versions 4 to 8
+//	}
 func getCodecFields(rType reflect.Type) []CodecField {
 	if _, ok := rType.(reflect.Type); !ok {
 		rType = rType.Elem()
@@ -26,27 +96,148 @@ func getCodecFields(rType reflect.Type) []CodecField {
 	if rType.Kind() == reflect.Ptr {
 		rType = rType.Elem()
 	}
+
+	fields := collectCodecFields(rType, nil, nil, 0, CodecField{}, map[reflect.Type]bool{rType: true})
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return lessOrder(fields[i].order, fields[j].order)
+	})
+
+	return fields
+}
+
+func collectCodecFields(rType reflect.Type, index, order []int, shift int, parent CodecField, visited map[reflect.Type]bool) []CodecField {
+
 	fieldsCount := rType.NumField()
 
 	var fields []CodecField
 
 	for i := 0; i < fieldsCount; i++ {
 		field := rType.Field(i)
-		tag := field.Tag.Get(TagNamespace)
 
-		codecField := unmarshalTag(tag, i, rType)
+		namespace := RasTagNamespace
+		tag, ok := field.Tag.Lookup(namespace)
+		if !ok {
+			namespace = TagNamespace
+			tag = field.Tag.Get(namespace)
+		}
+
+		if field.PkgPath != "" && (!field.Anonymous || field.Type.Kind() == reflect.Ptr) {
+			// Unexported fields cannot be set, except for the exported
+			// fields of an embedded struct value.
+			continue
+		}
+
+		codecField := unmarshalNamespaceTag(namespace, tag, i)
+		codecField.Name = field.Name
+		codecField.index = append(append([]int{}, index...), i)
+		codecField.order = append(append([]int{}, order...), shift+codecField.Number)
+		if codecField.Version < parent.Version {
+			codecField.Version = parent.Version
+		}
+		if parent.Removed != 0 && (codecField.Removed == 0 || codecField.Removed > parent.Removed) {
+			codecField.Removed = parent.Removed
+		}
+
+		if embedded, ok := flattened(field, codecField); ok && !visited[embedded] {
+			visited[embedded] = true
+
+			innerOrder, innerShift := codecField.order, 0
+			if codecField.hasOff {
+				innerOrder, innerShift = order, shift+codecField.Offset
+			}
+
+			fields = append(fields, collectCodecFields(embedded,
+				codecField.index, innerOrder, innerShift, codecField, visited)...)
+
+			delete(visited, embedded)
+			continue
+		}
+
 		fields = append(fields, codecField)
 	}
 
-	sort.Slice(fields, func(i, j int) bool {
-		return fields[i].Number < fields[j].Number
-	})
-
 	return fields
 }
 
+// flattened returns the struct type of an embedded field whose fields
+// are coded as fields of the parent.
+func flattened(field reflect.StructField, f CodecField) (reflect.Type, bool) {
+
+	if !field.Anonymous || f.Ignore || f.EncoderCodec() != "" || f.DecoderCodec() != "" {
+		return nil, false
+	}
+
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || t == timeType || t == timestampType {
+		return nil, false
+	}
+
+	pType := reflect.PtrTo(t)
+	for _, iface := range []reflect.Type{marshallerType, formatterType, unmarshalerType, parserType} {
+		if t.Implements(iface) || pType.Implements(iface) {
+			return nil, false
+		}
+	}
+
+	return t, true
+}
+
+func lessOrder(a, b []int) bool {
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+
+	return len(a) < len(b)
+}
+
 // Unmarshal decodes the tag into a prototype.CodecField.
-func unmarshalTag(tag string, fieldIdx int, rType reflect.Type) CodecField {
+//
+// A tag in the rac namespace starts with the codec name, the field number and
+// the version the field appeared in, for example `rac:"int64,2,10"`.
+// A tag in the ras namespace, as generated from the RAS protobuf schema,
+// starts with the field number, for example `ras:"1,version=5,decoder=string"`.
+//
+// Both may go on with named options:
+//
+//	codec=name          codec used to encode and decode the field
+//	encoder=name        codec used to encode the field
+//	decoder=name        codec used to decode the field
+//	number=N            field number
+//	version=N           protocol version the field appeared in
+//	removed=N           protocol version the field was removed in
+//	nullable            nil is written as NULL_BYTE
+//	discriminator=Field field holding the type id of an interface (see RegisterType)
+//	offset=N            number shift of an embedded struct (see getCodecFields)
+//
+// Other options are passed through to the codecs of the field.
+//
+// Malformed values are not fatal: they are recorded on the field
+// and reported by Validate.
+func unmarshalTag(tag string, fieldIdx int) CodecField {
+	return unmarshalNamespaceTag(TagNamespace, tag, fieldIdx)
+}
+
+// ParseTag parses a struct tag of the namespace, TagNamespace or RasTagNamespace,
+// as the Encoder and Decoder do. Malformed values are returned as an error.
+func ParseTag(namespace, tag string) (CodecField, error) {
+
+	f := unmarshalNamespaceTag(namespace, tag, 0)
+	if len(f.problems) > 0 {
+		return f, fmt.Errorf("ras: %s", strings.Join(f.problems, "; "))
+	}
+
+	return f, nil
+}
+
+func unmarshalNamespaceTag(namespace, tag string, fieldIdx int) CodecField {
 
 	f := CodecField{
 		fieldIdx: fieldIdx,
@@ -58,25 +249,131 @@ func unmarshalTag(tag string, fieldIdx int, rType reflect.Type) CodecField {
 		return f
 	}
 
+	// Positional values of the namespace, in order.
+	slots := []string{"codec", "number", "version"}
+	if namespace == RasTagNamespace {
+		slots = []string{"number", "version"}
+	}
+
+	pos := 0
 	for idx, v := range tags {
-		switch idx {
-		case 0:
-			switch v {
-			case "-":
-				f.Ignore = true
-			default:
-				f.codec = v
+
+		if idx == 0 && v == "-" {
+			f.Ignore = true
+			continue
+		}
+
+		key, value := v, ""
+		if i := strings.Index(v, "="); i >= 0 {
+			key, value = strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:])
+		} else if idx == 0 || !isTagFlag(v) {
+			if pos >= len(slots) {
+				f.problem("too many values in tag %q", tag)
+				continue
 			}
-		case 1:
-			n, _ := strconv.ParseInt(v, 10, 32)
+			key, value = slots[pos], v
+			pos++
+		}
+
+		switch key {
+		case "codec":
+			f.codec = value
+		case "encoder":
+			f.encoder = value
+		case "decoder":
+			f.decoder = value
+		case "number":
+			n := f.tagInt(key, value)
 			f.Number = int(n)
-		case 2:
-			n, _ := strconv.ParseInt(v, 10, 32)
+		case "version":
+			n := f.tagInt(key, value)
 			f.Version = int(n)
+		case "removed":
+			n := f.tagInt(key, value)
+			f.Removed = int(n)
+		case "nullable":
+			f.Nullable = true
+		case "offset":
+			n := f.tagInt(key, value)
+			f.Offset = int(n)
+			f.hasOff = true
+		case "discriminator":
+			f.Discriminator = value
 		default:
-			log.Fatalf("to many value in tag for field %s", rType.Name())
+			f.setOption(key, value)
 		}
 
 	}
 	return f
 }
+
+// tagInt parses the integer value of the tag key. An empty value is 0.
+func (f *CodecField) tagInt(key, value string) int {
+
+	if value == "" {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		f.problem("%s %q is not an integer", key, value)
+	}
+
+	return int(n)
+}
+
+// problem records a schema problem of the field, reported by Validate.
+func (f *CodecField) problem(format string, args ...interface{}) {
+	f.problems = append(f.problems, fmt.Sprintf(format, args...))
+}
+
+// isTagFlag reports whether v is an option without a value,
+// such as nullable, rather than a positional number or version.
+func isTagFlag(v string) bool {
+
+	if v == "" {
+		return false
+	}
+
+	_, err := strconv.Atoi(v)
+	return err != nil
+}
+
+func (f *CodecField) setOption(key, value string) {
+
+	if f.options == nil {
+		f.options = map[string]string{}
+	}
+	f.options[key] = value
+}
+
+// inVersion reports whether the field is present in the protocol version.
+func (f CodecField) inVersion(version int) bool {
+	return f.Version <= version && (f.Removed == 0 || version < f.Removed)
+}
+
+// Options returns the options of the tag that are passed through to the codecs.
+func (f CodecField) Options() map[string]string {
+	return f.options
+}
+
+// HasOffset reports whether the tag sets an offset, even a zero one.
+func (f CodecField) HasOffset() bool {
+	return f.hasOff
+}
+
+// EncoderCodec returns the name of the codec that encodes the field, if any.
+func (f CodecField) EncoderCodec() string {
+	if f.encoder != "" {
+		return f.encoder
+	}
+	return f.codec
+}
+
+// DecoderCodec returns the name of the codec that decodes the field, if any.
+func (f CodecField) DecoderCodec() string {
+	if f.decoder != "" {
+		return f.decoder
+	}
+	return f.codec
+}
@@ -0,0 +1,147 @@
+package ras
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_unmarshalNamespaceTag(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		namespace string
+		tag       string
+		want      CodecField
+	}{
+		{
+			"rac positional",
+			TagNamespace,
+			"int64,2,10",
+			CodecField{Number: 2, Version: 10, codec: "int64"},
+		},
+		{
+			"rac named",
+			TagNamespace,
+			",3,nullable,decoder=string,version=4",
+			CodecField{Number: 3, Version: 4, Nullable: true, decoder: "string"},
+		},
+		{
+			"ras",
+			RasTagNamespace,
+			"1,version=5,decoder=string",
+			CodecField{Number: 1, Version: 5, decoder: "string"},
+		},
+		{
+			"ras codec and pass-through options",
+			RasTagNamespace,
+			"7,codec=uuid,encoder=bytes,charset=cp1251,trim,removed=9",
+			CodecField{Number: 7, Removed: 9, codec: "uuid", encoder: "bytes",
+				options: map[string]string{"charset": "cp1251", "trim": ""}},
+		},
+		{
+			"ignore",
+			RasTagNamespace,
+			"-",
+			CodecField{Ignore: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unmarshalNamespaceTag(tt.namespace, tt.tag, 0)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unmarshalNamespaceTag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_RasTag(t *testing.T) {
+
+	registry := NewRegistry()
+	registry.RegisterEncoderType("upper-string", func(w io.Writer, value interface{}, opts ...map[string]string) (int, error) {
+		val := value.(string)
+		if len(opts) > 0 && opts[0]["case"] == "upper" {
+			val = strings.ToUpper(val)
+		}
+		return encodeString(w, val)
+	})
+
+	type sessionInfo struct {
+		UUID   string `ras:"1,version=5,decoder=string"`
+		ID     int32  `ras:"2"`
+		Host   string `ras:"3,encoder=upper-string,case=upper" rac:"-"`
+		Locale string `rac:"string,4"`
+	}
+
+	src := sessionInfo{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", 7, "srv", "ru"}
+
+	data, err := Encode(&src, 5, WithRegistry(registry))
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got sessionInfo
+	if _, err := Decode(data, &got, 5, WithRegistry(registry)); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	want := src
+	want.Host = "SRV"
+
+	if got != want {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestEncode_VersionRange(t *testing.T) {
+
+	type legacy struct {
+		Process string `rac:",1,removed=4"`
+	}
+
+	type session struct {
+		Host    string `rac:",1"`
+		License string `rac:",2,version=4,removed=9"`
+		legacy  `rac:",3"`
+		Port    int32 `rac:",4,version=2"`
+	}
+
+	src := session{"srv", "lic", legacy{"rphost"}, 1541}
+
+	tests := []struct {
+		version int
+		want    session
+	}{
+		{1, session{Host: "srv", legacy: legacy{"rphost"}}},
+		{3, session{Host: "srv", legacy: legacy{"rphost"}, Port: 1541}},
+		{4, session{Host: "srv", License: "lic", Port: 1541}},
+		{8, session{Host: "srv", License: "lic", Port: 1541}},
+		{9, session{Host: "srv", Port: 1541}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.version), func(t *testing.T) {
+
+			data, err := Encode(src, tt.version)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			var got session
+			n, err := Decode(data, &got, tt.version)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if n != len(data) {
+				t.Errorf("Decode() read %d bytes, want %d", n, len(data))
+			}
+
+			if got != tt.want {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package ras
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"strings"
+)
+
+// SchemaError reports the problems found in the tags of a struct type
+// and of the struct types it is made of, or in the tags options of a message.
+type SchemaError struct {
+	Type     reflect.Type
+	Message  protoreflect.FullName // set instead of Type for a message, see ProtoFields
+	Problems []string              // "Struct.Field: problem"
+}
+
+func (e *SchemaError) Error() string {
+
+	name := string(e.Message)
+	if e.Type != nil {
+		name = e.Type.String()
+	}
+
+	return "ras: invalid schema of " + name + ": " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the tags of the struct type t and of every struct type
+// reachable through its fields: malformed values, unknown codecs, field
+// numbers used twice within one version, bad discriminators and empty
+// version ranges. All problems are returned in one *SchemaError.
+//
+// Encode and Decode validate a struct type on first use and return
+// the same error instead of coding it.
+func Validate(t reflect.Type) error {
+	return defaultRegistry.Validate(t)
+}
+
+// Validate is like the package-level Validate, with the codecs of r.
+func (r *Registry) Validate(t reflect.Type) error {
+
+	var problems []string
+	r.visitSchema(t, map[reflect.Type]bool{}, func(t reflect.Type) {
+		if err, ok := r.cachedPlan(t).err.(*SchemaError); ok {
+			problems = append(problems, err.Problems...)
+		}
+	})
+
+	if len(problems) > 0 {
+		return &SchemaError{Type: t, Problems: problems}
+	}
+
+	return nil
+}
+
+// visitSchema calls fn for every struct type coded as part of t.
+func (r *Registry) visitSchema(t reflect.Type, visited map[reflect.Type]bool, fn func(reflect.Type)) {
+
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+			continue
+		}
+		break
+	}
+
+	if t.Kind() != reflect.Struct || visited[t] || t == timeType || t == timestampType {
+		return
+	}
+	visited[t] = true
+
+	fn(t)
+
+	for _, f := range r.cachedPlan(t).fields {
+		if f.EncoderCodec() == "" || f.DecoderCodec() == "" {
+			r.visitSchema(t.FieldByIndex(f.index).Type, visited, fn)
+		}
+	}
+}
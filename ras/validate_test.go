@@ -0,0 +1,63 @@
+package ras
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type badInner struct {
+	Name string `rac:"no-such-codec,1"`
+}
+
+func TestValidate(t *testing.T) {
+
+	type replaced struct {
+		Old  int `rac:",1,removed=4"`
+		New  int `rac:",1,version=4"`
+		Name string
+		Host string
+	}
+
+	if err := Validate(reflect.TypeOf(replaced{})); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	type bad struct {
+		ID    int        `rac:",1"`
+		Dup   int        `rac:",1,version=2"`
+		Count int        `rac:",3,4,5"`
+		Range int        `rac:",4,version=5,removed=5"`
+		Shape shape      `rac:",5,discriminator=Kind"`
+		Inner []badInner `rac:",6"`
+		Size  int        `rac:",7,version=v2"`
+		Late  shape      `rac:",8,discriminator=Next"`
+		Next  int        `rac:",9"`
+	}
+
+	err := Validate(reflect.TypeOf(&bad{}))
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("Validate() error = %v, want *SchemaError", err)
+	}
+
+	want := []string{
+		"bad.Dup: number 1 is already used by ID",
+		`bad.Count: too many values in tag ",3,4,5"`,
+		"bad.Range: removed in version 5, not after version 5",
+		"bad.Shape: discriminator field Kind not found",
+		`bad.Size: version "v2" is not an integer`,
+		"bad.Late: discriminator field Next comes after the field",
+		`badInner.Name: unknown encoder codec "no-such-codec"`,
+		`badInner.Name: unknown decoder codec "no-such-codec"`,
+	}
+
+	if !reflect.DeepEqual(schemaErr.Problems, want) {
+		t.Errorf("Validate() problems = %q, want %q", schemaErr.Problems, want)
+	}
+
+	if _, err := Encode(badInner{}, 1); !errors.As(err, &schemaErr) {
+		t.Errorf("Encode() error = %v, want *SchemaError", err)
+	}
+}
@@ -0,0 +1,194 @@
+package ras
+
+import (
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"reflect"
+)
+
+var _ Marshaller = Value{}
+var _ Unmarshaler = (*Value)(nil)
+
+// Value is a dynamically typed RAS value, such as an entry of a property list.
+//
+// On the wire it is the type byte followed by the payload of that type.
+// A Value without a type is written as NULL_BYTE and has no payload.
+//
+// Data holds the payload as the Go type listed for Type:
+//
+//	BOOLEAN        bool
+//	BYTE, TYPE     byte
+//	SHORT          int16
+//	INT            int32
+//	LONG           int64
+//	FLOAT          float32
+//	DOUBLE         float64
+//	SIZE           int
+//	NULLABLE_SIZE  int
+//	STRING         string
+//	UUID           uuid.UUID
+//	ENDPOINT_ID    int
+type Value struct {
+	Type TypeInterface
+	Data interface{}
+}
+
+type valueKind struct {
+	codec  string
+	goType reflect.Type
+}
+
+var valueKinds = map[TypeInterface]valueKind{
+	BOOLEAN:       {"bool", reflect.TypeOf(false)},
+	BYTE:          {"byte", reflect.TypeOf(byte(0))},
+	SHORT:         {"short", reflect.TypeOf(int16(0))},
+	INT:           {"int", reflect.TypeOf(int32(0))},
+	LONG:          {"long", reflect.TypeOf(int64(0))},
+	FLOAT:         {"float32", reflect.TypeOf(float32(0))},
+	DOUBLE:        {"double", reflect.TypeOf(float64(0))},
+	SIZE:          {"size", reflect.TypeOf(0)},
+	NULLABLE_SIZE: {"null-size", reflect.TypeOf(0)},
+	STRING:        {"string", reflect.TypeOf("")},
+	UUID:          {"uuid", reflect.TypeOf(uuid.UUID{})},
+	TYPE:          {"type", reflect.TypeOf(byte(0))},
+	ENDPOINT_ID:   {"null-size", reflect.TypeOf(0)},
+}
+
+// NewValue returns a Value of type t. Numeric data is converted
+// to the Go type of t; UUID data may also be a string or []byte.
+func NewValue(t TypeInterface, data interface{}) (Value, error) {
+
+	kind, ok := valueKinds[t]
+	if !ok {
+		return Value{}, &CodecError{Name: "value", Msg: fmt.Sprintf("unknown value type %d", t)}
+	}
+
+	if t == UUID {
+		var u uuid.UUID
+		switch typed := data.(type) {
+		case uuid.UUID:
+			u = typed
+		case string:
+			u = uuid.FromStringOrNil(typed)
+		case []byte:
+			u = uuid.FromBytesOrNil(typed)
+		default:
+			return Value{}, &CodecError{Name: "value", Msg: fmt.Sprintf("convert %T to uuid unsupported", data)}
+		}
+		return Value{t, u}, nil
+	}
+
+	rValue := reflect.ValueOf(data)
+	if !rValue.IsValid() || !rValue.Type().ConvertibleTo(kind.goType) ||
+		(rValue.Kind() == reflect.String) != (kind.goType.Kind() == reflect.String) {
+		return Value{}, &CodecError{Name: "value", Msg: fmt.Sprintf("convert %T to %s unsupported", data, t)}
+	}
+
+	return Value{t, rValue.Convert(kind.goType).Interface()}, nil
+}
+
+// IsNull reports whether v is the null value.
+func (v Value) IsNull() bool {
+	return v.Type == 0
+}
+
+// MarshalRAS writes the type of v and its data. Handed the writer of an
+// Encoder, it writes them with the codecs of the Encoder, see EncodeValue.
+func (v Value) MarshalRAS(writer io.Writer, version int) (int, error) {
+
+	if v.IsNull() {
+		return EncodeValue("type", writer, byte(NULL_BYTE))
+	}
+
+	kind, ok := valueKinds[v.Type]
+	if !ok {
+		return 0, &CodecError{Name: "value", Msg: fmt.Sprintf("unknown value type %d", v.Type)}
+	}
+
+	data := v.Data
+	if data == nil || reflect.TypeOf(data) != kind.goType {
+		typed, err := NewValue(v.Type, data)
+		if err != nil {
+			return 0, err
+		}
+		data = typed.Data
+	}
+
+	total, err := EncodeValue("type", writer, v.Type.Type())
+	if err != nil {
+		return total, err
+	}
+
+	n, err := EncodeValue(kind.codec, writer, data)
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// UnmarshalRAS reads a value written by MarshalRAS.
+func (v *Value) UnmarshalRAS(reader io.Reader, version int) (int, error) {
+
+	var typ byte
+	total, err := DecodeValue("type", reader, &typ)
+	if err != nil {
+		return total, err
+	}
+
+	if typ == NULL_BYTE {
+		*v = Value{}
+		return total, nil
+	}
+
+	kind, ok := valueKinds[TypeInterface(typ)]
+	if !ok {
+		return total, &CodecError{Name: "value", Msg: fmt.Sprintf("unknown value type %d", typ)}
+	}
+
+	data := reflect.New(kind.goType)
+	n, err := DecodeValue(kind.codec, reader, data.Interface())
+	total += n
+	if err != nil {
+		return total, err
+	}
+
+	*v = Value{TypeInterface(typ), data.Elem().Interface()}
+	return total, nil
+}
+
+func (t TypeInterface) String() string {
+
+	switch t {
+	case BOOLEAN:
+		return "BOOLEAN"
+	case BYTE:
+		return "BYTE"
+	case SHORT:
+		return "SHORT"
+	case INT:
+		return "INT"
+	case LONG:
+		return "LONG"
+	case FLOAT:
+		return "FLOAT"
+	case DOUBLE:
+		return "DOUBLE"
+	case SIZE:
+		return "SIZE"
+	case NULLABLE_SIZE:
+		return "NULLABLE_SIZE"
+	case STRING:
+		return "STRING"
+	case UUID:
+		return "UUID"
+	case TYPE:
+		return "TYPE"
+	case ENDPOINT_ID:
+		return "ENDPOINT_ID"
+	}
+
+	return fmt.Sprintf("TypeInterface(%d)", byte(t))
+}